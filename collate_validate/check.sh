@@ -2,3 +2,6 @@
 
 go build
 GOMAXPROCS=16 ./collate_validate -repeat 100 -count 10000 -seed 1591398756310399222
+./collate_validate -golden ../testdata/collate
+./collate_validate -strict ../testdata/scan_lenient
+./collate_validate -missing -count 1000
@@ -0,0 +1,134 @@
+package main
+
+import "crypto/sha1"
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
+import "log"
+import "os"
+import "path/filepath"
+import "sort"
+
+import "github.com/bnclabs/gson"
+
+// failcase is a failure saved into the corpus directory, it carries
+// enough to re-run the failing pipeline with -replay. Check is empty
+// for sort order failures, "pairs" for pairwise order failures and
+// "laws" for total order failures of the triple built from Inputs and
+// Mixseed.
+type failcase struct {
+	Seed     int       `json:"seed"`
+	Config   cfgparams `json:"config"`
+	Pipeline string    `json:"pipeline"`
+	Check    string    `json:"check,omitempty"`
+	Inputs   []string  `json:"inputs"`
+	Mixseed  int64     `json:"mixseed,omitempty"`
+	Error    string    `json:"error"`
+}
+
+// saveFailure save failing pipeline and its inputs into the corpus
+// directory, same failure saved more than once shall land on the same
+// file. Every failure is also remembered for the run report.
+func saveFailure(fc failcase, err error) {
+	fc.Error = err.Error()
+	statmu.Lock()
+	failures = append(failures, fc)
+	statmu.Unlock()
+
+	if options.corpus == "" {
+		return
+	}
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	key := []interface{}{fc.Config, fc.Pipeline, fc.Inputs}
+	if fc.Check != "" {
+		key = append(key, fc.Check, fc.Mixseed)
+	}
+	keydata, _ := json.Marshal(key)
+	filename := fmt.Sprintf("%v-%x.json", fc.Pipeline, sha1.Sum(keydata))
+	if err := os.MkdirAll(options.corpus, 0755); err != nil {
+		log.Fatal(err)
+	}
+	filename = filepath.Join(options.corpus, filename)
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("saved     : %v\n", filename)
+}
+
+// loadCorpus load failures from a corpus file or from every .json
+// file in a corpus directory.
+func loadCorpus(corpus string) ([]string, []failcase) {
+	fi, err := os.Stat(corpus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files := []string{corpus}
+	if fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(corpus, "*.json")); err != nil {
+			log.Fatal(err)
+		}
+		sort.Strings(files)
+	}
+	fcs := make([]failcase, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var fc failcase
+		if err := json.Unmarshal(data, &fc); err != nil {
+			log.Fatalf("%v: %v", file, err)
+		}
+		fcs = append(fcs, fc)
+	}
+	return files, fcs
+}
+
+// replayCorpus re-run every failure in corpus with the same config,
+// pipeline and inputs, return true if any of them continue to fail.
+func replayCorpus(corpus string) (failed bool) {
+	files, fcs := loadCorpus(corpus)
+	for i, fc := range fcs {
+		if fc.Check == "laws" {
+			config := fc.Config.config()
+			err := checkLaws(config, fc.Config, fc.Inputs, fc.Mixseed)
+			if err != nil {
+				fmt.Printf("replay %v ... fail: %v\n", files[i], err)
+				failed = true
+				continue
+			}
+			fmt.Printf("replay %v ... ok\n", files[i])
+			continue
+		}
+		var collate func(*gson.Config) collatefn
+		for _, pl := range pipelines {
+			if pl.name == fc.Pipeline {
+				collate = pl.collate
+			}
+		}
+		if collate == nil {
+			fmt.Printf("replay %v ... unknown pipeline %q\n", files[i], fc.Pipeline)
+			failed = true
+			continue
+		}
+		var err error
+		config := fc.Config.config()
+		fn := collate(config)
+		switch fc.Check {
+		case "pairs":
+			err = validateAllPairs(config, fc.Pipeline, fc.Inputs, fn)
+		default:
+			_, err = validateWith(fc.Config, fc.Pipeline, fc.Inputs, fn)
+		}
+		if err != nil {
+			fmt.Printf("replay %v ... fail: %v\n", files[i], err)
+			failed = true
+			continue
+		}
+		fmt.Printf("replay %v ... ok\n", files[i])
+	}
+	return failed
+}
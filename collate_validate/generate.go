@@ -48,6 +48,51 @@ func generateFloats(seed, count int, ch chan string) {
 	}
 }
 
+// generateLengths generate arrays and objects in pairs, a short one
+// with greater items and a long one with lesser items, so that sorting
+// by length first and sorting item by item disagree.
+func generateLengths(seed, count int, ch chan string) {
+	mrand := rand.New(rand.NewSource(int64(seed)))
+	items := func(n, from int) []interface{} {
+		arr := []interface{}{}
+		for i := 0; i < n; i++ {
+			arr = append(arr, from+mrand.Intn(50))
+		}
+		return arr
+	}
+	props := func(n int, from byte) map[string]interface{} {
+		m := map[string]interface{}{}
+		for len(m) < n {
+			key := string([]byte{from + byte(mrand.Intn(13))})
+			m[key] = mrand.Intn(50)
+		}
+		return m
+	}
+	for i := 0; i < count; i += 2 {
+		n, d := 1+mrand.Intn(3), 1+mrand.Intn(3)
+		var short, long interface{}
+		switch mrand.Intn(3) {
+		case 0:
+			short, long = items(n, 50), items(n+d, 0)
+		case 1:
+			short, long = props(n, 'n'), props(n+d, 'a')
+		default: // nested, length decides an inner container.
+			short = []interface{}{0, items(n, 50)}
+			long = []interface{}{0, items(n+d, 0)}
+		}
+		for j, val := range []interface{}{short, long} {
+			if i+j >= count {
+				break
+			}
+			outs, err := json.Marshal(val)
+			if err != nil {
+				panic(err)
+			}
+			ch <- string(outs)
+		}
+	}
+}
+
 func generateJSON(prodfile string, seed, count int, ch chan string) {
 	mrand := rand.New(rand.NewSource(int64(seed)))
 	bagdir := path.Dir(prodfile)
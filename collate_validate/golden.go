@@ -0,0 +1,134 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io/ioutil"
+import "log"
+import "path/filepath"
+import "sort"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// goldenfiles under testdata/collate, each input file has a .ref file
+// listing the same lines in collation order.
+var goldenfiles = []string{
+	"arrays", "basics", "numbers", "objects", "sortorder", "strings",
+}
+
+// goldenConfigs are configurations that shall not change the order
+// of golden files, that is, everything except the length-prefix
+// options which are left to their defaults, arrays sort item by item
+// and objects by number of properties first.
+func goldenConfigs() []cfgparams {
+	params := []cfgparams{}
+	for _, nk := range []string{"float", "smart"} {
+		for _, ws := range []string{"ansi", "unicode"} {
+			for _, ct := range []string{"lenprefix", "stream"} {
+				for _, missing := range []bool{false, true} {
+					params = append(params, cfgparams{
+						NumberKind: nk, SpaceKind: ws, Container: ct,
+						Missing: missing, PropertyLen: true,
+					})
+				}
+			}
+		}
+	}
+	return params
+}
+
+// validateGolden collate every line of every golden file, with every
+// pipeline under every golden config, and compare the sorted lines
+// with its .ref file. With update, .ref files are regenerated from the
+// first config and pipeline. Return true if any of them mismatch.
+func validateGolden(dir string, update bool) (failed bool) {
+	for _, name := range goldenfiles {
+		filename := filepath.Join(dir, name)
+		lines := readLines(filename)
+		if update {
+			params := goldenConfigs()[0]
+			config := params.config()
+			sorted := sortCollated(lines, pipelines[0].collate(config))
+			data := []byte(strings.Join(sorted, "\n") + "\n")
+			if err := ioutil.WriteFile(filename+".ref", data, 0644); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("updated   : %v.ref\n", filename)
+		}
+		refs := readLines(filename + ".ref")
+
+		mismatch := false
+		for _, params := range goldenConfigs() {
+			config := params.config()
+			for _, pl := range pipelines {
+				sorted := sortCollated(lines, pl.collate(config))
+				if diffLines(filename, config, pl.name, refs, sorted) {
+					mismatch = true
+				}
+			}
+		}
+		if failed = failed || mismatch; !mismatch {
+			fmt.Printf("golden    : %v ... ok\n", filename)
+		}
+	}
+	return failed
+}
+
+// sortCollated sort lines by their collated bytes, lines collating to
+// the same bytes are kept in their input order.
+func sortCollated(lines []string, collate collatefn) []string {
+	collated := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		collated = append(collated, collate([]byte(line)))
+	}
+	indices := make([]int, len(lines))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return bytes.Compare(collated[indices[i]], collated[indices[j]]) < 0
+	})
+	sorted := make([]string, 0, len(lines))
+	for _, i := range indices {
+		sorted = append(sorted, lines[i])
+	}
+	return sorted
+}
+
+func diffLines(
+	filename string, config *gson.Config, pipeline string,
+	refs, sorted []string) (failed bool) {
+
+	for i := 0; i < len(refs) || i < len(sorted); i++ {
+		ref, out := "<none>", "<none>"
+		if i < len(refs) {
+			ref = refs[i]
+		}
+		if i < len(sorted) {
+			out = sorted[i]
+		}
+		if ref != out {
+			if !failed {
+				fmt.Printf("golden    : %v with %v\n", filename, pipeline)
+				fmt.Printf("config    : %v\n", config)
+			}
+			fmt.Printf("  line %3d: expected %v, got %v\n", i+1, ref, out)
+			failed = true
+		}
+	}
+	return failed
+}
+
+func readLines(filename string) []string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
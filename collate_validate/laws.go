@@ -0,0 +1,306 @@
+package main
+
+import "fmt"
+import "math"
+import "math/rand"
+import "reflect"
+import "sort"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// allConfigs is every combination of cfgparams.
+func allConfigs() []cfgparams {
+	params := []cfgparams{}
+	bools := []bool{false, true}
+	for _, nk := range []string{"float", "smart"} {
+		for _, ws := range []string{"ansi", "unicode"} {
+			for _, ct := range []string{"lenprefix", "stream"} {
+				for _, arrlen := range bools {
+					for _, proplen := range bools {
+						for _, missing := range bools {
+							for _, strict := range bools {
+								params = append(params, cfgparams{
+									NumberKind: nk, SpaceKind: ws,
+									Container: ct, ArrayLen: arrlen,
+									PropertyLen: proplen, Missing: missing,
+									Strict: strict,
+								})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return params
+}
+
+// validateLaws check that Value.Compare is a total order, under every
+// config, on ntriples random triples drawn from inputs. Return true if
+// any triple violates reflexivity, antisymmetry, transitivity or
+// consistency with equality.
+func validateLaws(seed int, inputs []string, ntriples int) (failed bool) {
+	if len(inputs) == 0 {
+		return false
+	}
+	configs := allConfigs()
+	for _, params := range configs {
+		mrand := rand.New(rand.NewSource(int64(seed)))
+		config := params.config()
+		for i := 0; i < ntriples; i++ {
+			texts := drawTriple(mrand, inputs)
+			mixseed := mrand.Int63()
+			err := checkLaws(config, params, texts, mixseed)
+			if err == nil {
+				continue
+			}
+			fmt.Printf("laws      : %v\n", config)
+			fmt.Printf("%v\n", err)
+			fc := failcase{
+				Seed: seed, Config: params, Pipeline: "Value.Compare",
+				Check: "laws", Inputs: texts, Mixseed: mixseed,
+			}
+			saveFailure(fc, err)
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		fmsg := "laws      : %v triples under %v configs ... ok\n"
+		fmt.Printf(fmsg, ntriples, len(configs))
+	}
+	return failed
+}
+
+// drawTriple pick three inputs, later ones repeat an earlier one often
+// enough for equal values to be compared.
+func drawTriple(mrand *rand.Rand, inputs []string) []string {
+	texts := []string{}
+	for i := 0; i < 3; i++ {
+		if i > 0 && mrand.Intn(3) == 0 {
+			texts = append(texts, texts[mrand.Intn(i)])
+			continue
+		}
+		texts = append(texts, inputs[mrand.Intn(len(inputs))])
+	}
+	return texts
+}
+
+// lawTriple parse texts under config and mix the numbers in them
+// across golang kinds, with Missing inserted when params use it. The
+// same mixseed shall give the same triple.
+func lawTriple(
+	config *gson.Config, params cfgparams, texts []string,
+	mixseed int64) []interface{} {
+
+	mrand := rand.New(rand.NewSource(mixseed))
+	triple := []interface{}{}
+	for _, text := range texts {
+		_, value := config.NewJson([]byte(text)).Tovalue()
+		triple = append(triple, mixKinds(mrand, params.Missing, value, true))
+	}
+	return triple
+}
+
+// mixKinds return a copy of value with integral numbers turned into
+// float64, int64 or uint64 at random. With missing, arrays may gain a
+// Missing item and the root itself may become Missing.
+func mixKinds(
+	mrand *rand.Rand, missing bool, value interface{},
+	root bool) interface{} {
+
+	if missing && root && mrand.Intn(16) == 0 {
+		return gson.MissingLiteral
+	}
+	switch v := value.(type) {
+	case float64, int64, uint64:
+		f := tofloat(v)
+		if f != math.Trunc(f) || math.Abs(f) > (1<<53) {
+			return v
+		}
+		switch n := mrand.Intn(3); {
+		case n == 1:
+			return int64(f)
+		case n == 2 && f >= 0:
+			return uint64(f)
+		}
+		return f
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v)+1)
+		for _, item := range v {
+			arr = append(arr, mixKinds(mrand, missing, item, false))
+		}
+		if missing && mrand.Intn(8) == 0 {
+			i := mrand.Intn(len(arr) + 1)
+			arr = append(arr, nil)
+			copy(arr[i+1:], arr[i:])
+			arr[i] = gson.MissingLiteral
+		}
+		return arr
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = mixKinds(mrand, missing, item, false)
+		}
+		return m
+	}
+	return value
+}
+
+// checkLaws check the total order laws on the triple built from texts.
+func checkLaws(
+	config *gson.Config, params cfgparams, texts []string,
+	mixseed int64) (err error) {
+
+	triple := lawTriple(config, params, texts, mixseed)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%v", r, describeTriple(triple))
+		}
+	}()
+
+	names := []string{"a", "b", "c"}
+	cmps := [3][3]int{}
+	for i, x := range triple {
+		for j, y := range triple {
+			cmps[i][j] = sign(config.NewValue(x).Compare(config.NewValue(y)))
+		}
+	}
+	violations := []string{}
+	violate := func(fmsg string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(fmsg, args...))
+	}
+	for i := range triple {
+		if cmps[i][i] != 0 {
+			violate("reflexivity: %v vs itself is %v", names[i], cmps[i][i])
+		}
+		for j := range triple {
+			if cmps[i][j] != -cmps[j][i] {
+				fmsg := "antisymmetry: %v vs %v is %v, %v vs %v is %v"
+				violate(fmsg, names[i], names[j], cmps[i][j],
+					names[j], names[i], cmps[j][i])
+			}
+			if i != j && jsonEqual(triple[i], triple[j]) && cmps[i][j] != 0 {
+				fmsg := "equality: %v equals %v, yet compare is %v"
+				violate(fmsg, names[i], names[j], cmps[i][j])
+			}
+			for k := range triple {
+				ij, jk, ik := cmps[i][j], cmps[j][k], cmps[i][k]
+				if ij <= 0 && jk <= 0 && (ik > 0 || (ik == 0 && ij+jk < 0)) {
+					fmsg := "transitivity: %v vs %v is %v, %v vs %v is %v, " +
+						"%v vs %v is %v"
+					violate(fmsg, names[i], names[j], ij, names[j],
+						names[k], jk, names[i], names[k], ik)
+				}
+				if ij == 0 && cmps[i][k] != cmps[j][k] {
+					fmsg := "equality: %v equals %v, yet against %v " +
+						"compare is %v and %v"
+					violate(fmsg, names[i], names[j], names[k], ik, jk)
+				}
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Strings(violations)
+	violations = dedup(violations)
+	return fmt.Errorf("%v\n%v", strings.Join(violations, "\n"),
+		describeTriple(triple))
+}
+
+// jsonEqual is equality of JSON values regardless of the golang kind
+// numbers are held in, numbers are compared exactly.
+func jsonEqual(x, y interface{}) bool {
+	switch a := x.(type) {
+	case float64, int64, uint64, int:
+		switch y.(type) {
+		case float64, int64, uint64, int:
+			return refNumber(a).Cmp(refNumber(y)) == 0
+		}
+		return false
+	case []interface{}:
+		b, ok := y.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := y.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, item := range a {
+			if other, ok := b[key]; !ok || !jsonEqual(item, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func tofloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return value.(float64)
+}
+
+// describeTriple print every value of the triple with golang kinds.
+func describeTriple(triple []interface{}) string {
+	lines := []string{}
+	for i, value := range triple {
+		lines = append(lines, fmt.Sprintf("  %c: %v", 'a'+i, typed(value)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// typed render value like JSON text, numbers carry their golang kind.
+func typed(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case gson.Missing:
+		return "missing"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, typed(item))
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := []string{}
+		for _, key := range keys {
+			items = append(items, fmt.Sprintf("%q:%v", key, typed(v[key])))
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	}
+	return fmt.Sprintf("%T(%v)", value, value)
+}
+
+func dedup(sorted []string) []string {
+	out := []string{}
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
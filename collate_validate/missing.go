@@ -0,0 +1,380 @@
+package main
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "math/rand"
+import "reflect"
+import "runtime"
+
+import "github.com/bnclabs/gson"
+
+// missingConfigs are configurations that can change how Missing is
+// collated, with and without UseMissing.
+func missingConfigs() []cfgparams {
+	params := []cfgparams{}
+	for _, nk := range []string{"float", "smart"} {
+		for _, ct := range []string{"lenprefix", "stream"} {
+			for _, missing := range []bool{true, false} {
+				params = append(params, cfgparams{
+					NumberKind: nk, SpaceKind: "ansi", Container: ct,
+					Missing: missing, PropertyLen: true,
+				})
+			}
+		}
+	}
+	return params
+}
+
+// valuechains collate golang values, that can hold gson.Missing,
+// in different ways.
+var valuechains = []struct {
+	name    string
+	collate func(config *gson.Config, value interface{}) []byte
+}{
+	{"ValueToCollate", func(config *gson.Config, value interface{}) []byte {
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return config.NewValue(value).Tocollate(clt).Bytes()
+	}},
+	{"ValueToCborToCollate", func(
+		config *gson.Config, value interface{}) []byte {
+
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return config.NewValue(value).Tocbor(cbr).Tocollate(clt).Bytes()
+	}},
+	{"ValueToCborToValueToCollate", func(
+		config *gson.Config, value interface{}) []byte {
+
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		value = config.NewValue(value).Tocbor(cbr).Tovalue()
+		return config.NewValue(value).Tocollate(clt).Bytes()
+	}},
+}
+
+// roundtrips take golang values, that can hold gson.Missing, through
+// a chain and back into golang values.
+var roundtrips = []struct {
+	name string
+	fn   func(config *gson.Config, value interface{}) interface{}
+}{
+	{"ValueToCborToValue", func(
+		config *gson.Config, value interface{}) interface{} {
+
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		value = config.NewValue(value).Tocbor(cbr).Tovalue()
+		return gson.CborMap2golangMap(value)
+	}},
+	{"ValueToCollateToValue", func(
+		config *gson.Config, value interface{}) interface{} {
+
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return config.NewValue(value).Tocollate(clt).Tovalue()
+	}},
+	{"ValueToCollateToCborToValue", func(
+		config *gson.Config, value interface{}) interface{} {
+
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		value = config.NewValue(value).Tocollate(clt).Tocbor(cbr).Tovalue()
+		return gson.CborMap2golangMap(value)
+	}},
+	{"ValueToCborToCollateToValue", func(
+		config *gson.Config, value interface{}) interface{} {
+
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return config.NewValue(value).Tocbor(cbr).Tocollate(clt).Tovalue()
+	}},
+	{"ValueToJsonToValue", func(
+		config *gson.Config, value interface{}) interface{} {
+
+		jsn := config.NewJson(make([]byte, 0, 1024))
+		_, value = config.NewValue(value).Tojson(jsn).Tovalue()
+		return value
+	}},
+}
+
+// missingValues are golang values holding Missing, that are always
+// checked along with generated ones, starting with Missing and null.
+var missingValues = []interface{}{
+	gson.MissingLiteral, nil, false, 0.0, "", []interface{}{},
+	[]interface{}{gson.MissingLiteral}, []interface{}{nil},
+	[]interface{}{gson.MissingLiteral, nil},
+	[]interface{}{nil, gson.MissingLiteral},
+	map[string]interface{}{"a": []interface{}{gson.MissingLiteral}},
+}
+
+// generateMissing generate golang values with Missing as items of
+// arrays and as values by themselves, mixed with values it sorts next
+// to.
+func generateMissing(seed, count int) []interface{} {
+	mrand := rand.New(rand.NewSource(int64(seed)))
+	var gen func(depth int) interface{}
+	gen = func(depth int) interface{} {
+		n := 6
+		if depth == 0 {
+			n = 5
+		}
+		switch mrand.Intn(n) {
+		case 0:
+			return gson.MissingLiteral
+		case 1:
+			return nil
+		case 2:
+			return mrand.Intn(2) == 0
+		case 3:
+			return float64(mrand.Intn(10) - 5)
+		case 4:
+			return []string{"", "a", "~"}[mrand.Intn(3)]
+		}
+		arr := []interface{}{}
+		for i := mrand.Intn(4); i > 0; i-- {
+			arr = append(arr, gen(depth-1))
+		}
+		return arr
+	}
+	values := append([]interface{}{}, missingValues...)
+	for i := 0; i < count; i++ {
+		values = append(values, gen(2))
+	}
+	return values
+}
+
+// validateMissing collate count generated values holding Missing, as
+// golang values with every value chain and as the equivalent JSON text
+// with every pipeline, where Missing is gson.MissingLiteral. With
+// UseMissing, Missing shall sort below null and golang values shall
+// collate the same as their JSON text. Without UseMissing,
+// MissingLiteral is a plain string in JSON text and a gson.Missing
+// value shall be rejected or collated as that string. Collated JSON
+// text shall decode back to itself either way, and with UseMissing
+// golang values shall come back the same through cbor, collate and
+// JSON round trips. Return true if any of them fail.
+func validateMissing(seed, count int) (failed bool) {
+	values := generateMissing(seed, count)
+	texts := make([]string, 0, len(values))
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			panic(err)
+		}
+		texts = append(texts, string(data))
+	}
+
+	for _, params := range missingConfigs() {
+		config := params.config()
+		fails := []string{}
+		fail := func(fmsg string, args ...interface{}) {
+			fails = append(fails, fmt.Sprintf(fmsg, args...))
+		}
+
+		for _, pl := range pipelines {
+			collate := pl.collate(config)
+			collated := make([][]byte, 0, len(texts))
+			for _, text := range texts {
+				out, err := missingCall(func() []byte {
+					return collate([]byte(text))
+				})
+				if err != nil {
+					fail("%v %v: %v", pl.name, text, err)
+					break
+				}
+				collated = append(collated, out)
+			}
+			if len(collated) != len(texts) {
+				continue
+			}
+			below := bytes.Compare(collated[0], collated[1]) < 0
+			if params.Missing && !below {
+				fail("%v: missing does not sort below null", pl.name)
+			}
+			sorted := []interface{}{}
+			for _, text := range sortCollated(texts, collate) {
+				sorted = append(sorted, missingModel(params, text))
+			}
+			order := refOrderOf(params)
+			if err := order.checkSorted(pl.name, sorted); err != nil {
+				fail("%v", err)
+			}
+		}
+
+		jsoncollate := pipelines[0].collate(config)
+		for _, chain := range valuechains {
+			for i, value := range values {
+				ref, err := missingCall(func() []byte {
+					return jsoncollate([]byte(texts[i]))
+				})
+				if err != nil { // already reported with pipelines.
+					continue
+				}
+				out, err := missingCall(func() []byte {
+					return chain.collate(config, value)
+				})
+				switch {
+				case err != nil && !params.Missing && !isRuntime(err):
+				case err != nil:
+					fail("%v %v: %v", chain.name, typed(value), err)
+				case !bytes.Equal(out, ref):
+					fmsg := "%v %v: collates differently from %v"
+					fail(fmsg, chain.name, typed(value), texts[i])
+				}
+			}
+		}
+
+		for _, text := range texts {
+			if err := missingRoundtrip(config, text); err != nil {
+				fail("%v", err)
+			}
+		}
+		if params.Missing {
+			for _, value := range values {
+				for _, err := range valueRoundtrips(config, value) {
+					fail("%v", err)
+				}
+			}
+		}
+
+		if len(fails) == 0 {
+			fmsg := "missing   : %v values under %v ... ok\n"
+			fmt.Printf(fmsg, len(values), config)
+			continue
+		}
+		fmt.Printf("missing   : %v\n", config)
+		for _, msg := range fails {
+			fmt.Printf("  %v\n", msg)
+		}
+		failed = true
+	}
+	return failed
+}
+
+// missingModel parse text with encoding/json, with UseMissing the
+// MissingLiteral string is Missing.
+func missingModel(params cfgparams, text string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		panic(err)
+	}
+	if !params.Missing {
+		return value
+	}
+	var fix func(value interface{}) interface{}
+	fix = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if v == string(gson.MissingLiteral) {
+				return gson.MissingLiteral
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = fix(item)
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = fix(item)
+			}
+		}
+		return value
+	}
+	return fix(value)
+}
+
+// missingRoundtrip collate text and decode it back into JSON text,
+// MissingLiteral shall come back as it went in.
+func missingRoundtrip(config *gson.Config, text string) error {
+	var ref, value interface{}
+	out, err := missingCall(func() []byte {
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		jsn := config.NewJson(make([]byte, 0, 1024))
+		config.NewJson([]byte(text)).Tocollate(clt)
+		return clt.Tojson(jsn).Bytes()
+	})
+	if err != nil {
+		return fmt.Errorf("round trip %v: %v", text, err)
+	}
+	json.Unmarshal([]byte(text), &ref)
+	if err := json.Unmarshal(out, &value); err != nil {
+		return fmt.Errorf("round trip %v: %v in %s", text, err, out)
+	} else if !reflect.DeepEqual(ref, value) {
+		return fmt.Errorf("round trip %v: got %s", text, out)
+	}
+	return nil
+}
+
+// valueRoundtrips take value through every round trip, Missing shall
+// come back as Missing, except through JSON text where it is the
+// MissingLiteral string.
+func valueRoundtrips(config *gson.Config, value interface{}) []error {
+	errs := []error{}
+	for _, rt := range roundtrips {
+		var out interface{}
+		_, err := missingCall(func() []byte {
+			out = rt.fn(config, value)
+			return nil
+		})
+		ref := value
+		if rt.name == "ValueToJsonToValue" {
+			ref, out = unmissing(ref), unmissing(out)
+		}
+		name := rt.name + " " + typed(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", name, err))
+		} else if !jsonEqual(ref, out) {
+			errs = append(errs, fmt.Errorf("%v: got %v", name, typed(out)))
+		}
+	}
+	return errs
+}
+
+// unmissing return a copy of value with Missing as MissingLiteral
+// string.
+func unmissing(value interface{}) interface{} {
+	switch v := value.(type) {
+	case gson.Missing:
+		return string(v)
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			arr = append(arr, unmissing(item))
+		}
+		return arr
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = unmissing(item)
+		}
+		return m
+	}
+	return value
+}
+
+// missingCall call fn, turning a panic into an error.
+func missingCall(fn func() []byte) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr, ok := r.(runtime.Error); ok {
+				out, err = nil, runtimeError{rerr}
+				return
+			}
+			out, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return fn(), nil
+}
+
+// runtimeError is a golang runtime error raised from within gson, as
+// against an error raised by gson.
+type runtimeError struct {
+	err runtime.Error
+}
+
+func (err runtimeError) Error() string {
+	return err.err.Error()
+}
+
+func isRuntime(err error) bool {
+	_, ok := err.(runtimeError)
+	return ok
+}
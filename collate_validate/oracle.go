@@ -0,0 +1,127 @@
+package main
+
+import "fmt"
+import "math/big"
+import "sort"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// refOrder is the documented gson/N1QL ordering written from scratch,
+// sharing no code with gson, so that Value.Compare and the collated
+// byte order can be checked against it. Values are ordered first by
+// type, missing < null < false < true < number < string < array <
+// object. Numbers compare by value irrespective of their golang kind,
+// strings compare byte wise. With arraylen, shorter arrays sort before
+// longer ones, otherwise arrays compare item by item and a prefix sorts
+// first. Objects compare the same way, with propertylen for the number
+// of properties, over their properties sorted by key, each property
+// comparing its key and then its value.
+type refOrder struct {
+	arraylen    bool
+	propertylen bool
+}
+
+func refOrderOf(params cfgparams) refOrder {
+	return refOrder{arraylen: params.ArrayLen, propertylen: params.PropertyLen}
+}
+
+func refRank(value interface{}) int {
+	switch v := value.(type) {
+	case gson.Missing:
+		return 0
+	case nil:
+		return 1
+	case bool:
+		if v {
+			return 3
+		}
+		return 2
+	case float64, int64, uint64, int:
+		return 4
+	case string:
+		return 5
+	case []interface{}:
+		return 6
+	case map[string]interface{}:
+		return 7
+	}
+	panic(fmt.Errorf("refRank: unexpected %T", value))
+}
+
+// compare x and y, return -1, 0 or +1.
+func (o refOrder) compare(x, y interface{}) int {
+	if rx, ry := refRank(x), refRank(y); rx != ry {
+		return sign(rx - ry)
+	}
+	switch a := x.(type) {
+	case float64, int64, uint64, int:
+		return refNumber(a).Cmp(refNumber(y))
+	case string:
+		return strings.Compare(a, y.(string))
+	case []interface{}:
+		b := y.([]interface{})
+		if o.arraylen && len(a) != len(b) {
+			return sign(len(a) - len(b))
+		}
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if cmp := o.compare(a[i], b[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		return sign(len(a) - len(b))
+	case map[string]interface{}:
+		b := y.(map[string]interface{})
+		if o.propertylen && len(a) != len(b) {
+			return sign(len(a) - len(b))
+		}
+		akeys, bkeys := sortedKeys(a), sortedKeys(b)
+		for i := 0; i < len(akeys) && i < len(bkeys); i++ {
+			if cmp := strings.Compare(akeys[i], bkeys[i]); cmp != 0 {
+				return cmp
+			}
+			if cmp := o.compare(a[akeys[i]], b[bkeys[i]]); cmp != 0 {
+				return cmp
+			}
+		}
+		return sign(len(akeys) - len(bkeys))
+	}
+	return 0 // missing, null, false and true are equal to themselves.
+}
+
+// refNumber is the exact value of number.
+func refNumber(number interface{}) *big.Float {
+	switch v := number.(type) {
+	case float64:
+		return new(big.Float).SetFloat64(v)
+	case int64:
+		return new(big.Float).SetInt64(v)
+	case uint64:
+		return new(big.Float).SetUint64(v)
+	case int:
+		return new(big.Float).SetInt64(int64(v))
+	}
+	panic(fmt.Errorf("refNumber: unexpected %T", number))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkSorted check that values are in non-decreasing order under o,
+// what names the sort being checked.
+func (o refOrder) checkSorted(what string, values []interface{}) error {
+	for i := 1; i < len(values); i++ {
+		if o.compare(values[i-1], values[i]) > 0 {
+			fmsg := "%v out of order at index %v, %v sorts after %v"
+			prev, next := typed(values[i-1]), typed(values[i])
+			return fmt.Errorf(fmsg, what, i, prev, next)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import "encoding/json"
+import "math"
+import "path/filepath"
+import "sort"
+import "strings"
+import "testing"
+
+import "github.com/bnclabs/gson"
+
+// TestRefOrderGolden sort every golden file with refOrder, under the
+// golden defaults, and compare with its .ref file.
+func TestRefOrderGolden(t *testing.T) {
+	order := refOrder{arraylen: false, propertylen: true}
+	for _, name := range goldenfiles {
+		filename := filepath.Join("..", "testdata", "collate", name)
+		lines := readLines(filename)
+		values := make([]interface{}, 0, len(lines))
+		for _, line := range lines {
+			values = append(values, parseNumbers(t, line))
+		}
+		indices := make([]int, len(lines))
+		for i := range indices {
+			indices[i] = i
+		}
+		sort.SliceStable(indices, func(i, j int) bool {
+			return order.compare(values[indices[i]], values[indices[j]]) < 0
+		})
+		refs := readLines(filename + ".ref")
+		for i, ref := range refs {
+			if out := lines[indices[i]]; out != ref {
+				t.Errorf("%v line %v: expected %v, got %v", name, i+1, ref, out)
+			}
+		}
+	}
+}
+
+func TestRefOrderObjects(t *testing.T) {
+	// documented N1QL collation, number of properties first, then in
+	// sorted key order, key and then value for every property.
+	lenfirst := []string{
+		`{}`,
+		`{"a":null}`,
+		`{"a":false}`,
+		`{"a":1}`,
+		`{"a":2}`,
+		`{"b":1}`,
+		`{"z":[]}`,
+		`{"a":1,"b":2}`,
+		`{"a":1,"c":0}`,
+		`{"a":2,"b":0}`,
+		`{"b":0,"c":0}`,
+		`{"a":0,"b":0,"c":0}`,
+	}
+	checkOrder(t, refOrder{propertylen: true}, lenfirst)
+
+	lexical := []string{
+		`{}`,
+		`{"a":1}`,
+		`{"a":1,"b":0}`,
+		`{"a":1,"b":0,"c":0}`,
+		`{"a":2}`,
+		`{"b":0}`,
+		`{"z":1}`,
+	}
+	checkOrder(t, refOrder{propertylen: false}, lexical)
+}
+
+func TestRefOrderArrays(t *testing.T) {
+	checkOrder(t, refOrder{arraylen: true}, []string{
+		`[]`, `[9]`, `[[9]]`, `[1,2]`, `[1,3]`, `[2,0]`, `[0,0,0]`,
+	})
+	checkOrder(t, refOrder{arraylen: false}, []string{
+		`[]`, `[0,0,0]`, `[1,2]`, `[1,3]`, `[2,0]`, `[9]`, `[[9]]`,
+	})
+}
+
+func TestRefOrderTypes(t *testing.T) {
+	order := refOrder{propertylen: true}
+	values := []interface{}{
+		gson.MissingLiteral, nil, false, true, -1.5, int64(0), uint64(1),
+		"", "a", []interface{}{}, map[string]interface{}{},
+	}
+	for i := 1; i < len(values); i++ {
+		if cmp := order.compare(values[i-1], values[i]); cmp >= 0 {
+			t.Errorf("%v vs %v: expected -1, got %v",
+				typed(values[i-1]), typed(values[i]), cmp)
+		}
+	}
+
+	numbers := []struct {
+		x, y interface{}
+		cmp  int
+	}{
+		{int64(1), 1.0, 0},
+		{uint64(1), int64(1), 0},
+		{int64(-1), uint64(0), -1},
+		{float64(1 << 53), int64(1<<53 + 1), -1},
+		{int64(math.MaxInt64), uint64(1 << 63), -1},
+		{0.5, int64(0), 1},
+	}
+	for _, n := range numbers {
+		if cmp := order.compare(n.x, n.y); cmp != n.cmp {
+			t.Errorf("%v vs %v: expected %v, got %v",
+				typed(n.x), typed(n.y), n.cmp, cmp)
+		}
+	}
+}
+
+// checkOrder check that texts are in strictly increasing order, under
+// order, for every pair of them.
+func checkOrder(t *testing.T, order refOrder, texts []string) {
+	for i, x := range texts {
+		for j, y := range texts {
+			ref := sign(i - j)
+			cmp := order.compare(parseNumbers(t, x), parseNumbers(t, y))
+			if cmp != ref {
+				t.Errorf("%+v %v vs %v: expected %v, got %v",
+					order, x, y, ref, cmp)
+			}
+		}
+	}
+}
+
+// parseNumbers parse text with integers as int64 and other numbers as
+// float64.
+func parseNumbers(t *testing.T, text string) interface{} {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		t.Fatalf("%v: %v", text, err)
+	}
+	var fix func(value interface{}) interface{}
+	fix = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return n
+			}
+			f, _ := v.Float64()
+			return f
+		case []interface{}:
+			for i, item := range v {
+				v[i] = fix(item)
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = fix(item)
+			}
+		}
+		return value
+	}
+	return fix(value)
+}
@@ -0,0 +1,75 @@
+package main
+
+import "bytes"
+import "fmt"
+import "math/rand"
+
+import "github.com/bnclabs/gson"
+
+// validatePairs draw npairs random pairs (a, b) from inputs and check
+// that collated a and b compare, byte wise, the same as Value.Compare
+// on a and b. Unlike sorting, this does not let ties and values that
+// are equal but collate differently hide each other. Return the first
+// pair that disagree.
+func validatePairs(
+	config *gson.Config, nm string, inputs []string, fn collatefn,
+	mrand *rand.Rand, npairs int) ([]string, error) {
+
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	for i := 0; i < npairs; i++ {
+		a := inputs[mrand.Intn(len(inputs))]
+		b := inputs[mrand.Intn(len(inputs))]
+		if err := comparePair(config, fn, a, b); err != nil {
+			fmt.Printf("pair      : %v\n", err)
+			return []string{a, b}, fmt.Errorf("%v: %v", nm, err)
+		}
+	}
+	fmt.Printf("%-30v: %v pairs ... ok\n", nm, npairs)
+	return nil, nil
+}
+
+// validateAllPairs check every ordered pair in inputs, used to replay
+// a saved pair.
+func validateAllPairs(
+	config *gson.Config, nm string, inputs []string, fn collatefn) error {
+
+	for _, a := range inputs {
+		for _, b := range inputs {
+			if err := comparePair(config, fn, a, b); err != nil {
+				return fmt.Errorf("%v: %v", nm, err)
+			}
+		}
+	}
+	return nil
+}
+
+// comparePair check that sign of bytes.Compare on collated a and b is
+// the sign of Value.Compare on a and b.
+func comparePair(config *gson.Config, fn collatefn, a, b string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pair %q %q: panic: %v", a, b, r)
+		}
+	}()
+
+	_, va := config.NewJson([]byte(a)).Tovalue()
+	_, vb := config.NewJson([]byte(b)).Tovalue()
+	want := sign(config.NewValue(va).Compare(config.NewValue(vb)))
+	ca, cb := fn([]byte(a)), fn([]byte(b))
+	if got := sign(bytes.Compare(ca, cb)); got != want {
+		fmsg := "pair %q %q: collated %v, Compare %v, collated %x vs %x"
+		return fmt.Errorf(fmsg, a, b, got, want, ca, cb)
+	}
+	return nil
+}
+
+func sign(cmp int) int {
+	if cmp < 0 {
+		return -1
+	} else if cmp > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+package main
+
+import "encoding/json"
+import "encoding/xml"
+import "fmt"
+import "io/ioutil"
+import "log"
+import "strings"
+import "sync"
+import "time"
+
+// pipelinerun is the outcome of validating a pipeline for a seed.
+type pipelinerun struct {
+	Seed      int       `json:"seed"`
+	Pipeline  string    `json:"pipeline"`
+	Params    cfgparams `json:"params"`
+	Config    string    `json:"config"`
+	Items     int       `json:"items"`
+	Collate   float64   `json:"collate"`   // seconds to collate inputs
+	Sortjson  float64   `json:"sortjson"`  // seconds to sort with Compare
+	Sortbytes float64   `json:"sortbytes"` // seconds to sort collated
+	Compares  int       `json:"compares"`
+	Pairs     int       `json:"pairs"` // random pairs checked
+	Error     string    `json:"error,omitempty"`
+}
+
+var statmu sync.Mutex
+var runs = []pipelinerun{}
+var failures = []failcase{}
+var typecounts = map[string]int{}
+
+func bookrun(run pipelinerun) {
+	statmu.Lock()
+	defer statmu.Unlock()
+	runs = append(runs, run)
+}
+
+// booktype count the JSON type of input.
+func booktype(input string) {
+	typ := "num"
+	switch s := strings.TrimSpace(input); {
+	case s == "null":
+		typ = "null"
+	case s == "true":
+		typ = "true"
+	case s == "false":
+		typ = "false"
+	case strings.HasPrefix(s, `"`):
+		typ = "string"
+	case strings.HasPrefix(s, "["):
+		typ = "array"
+	case strings.HasPrefix(s, "{"):
+		typ = "object"
+	}
+	statmu.Lock()
+	defer statmu.Unlock()
+	typecounts[typ]++
+}
+
+// passfail count for a pipeline across seeds.
+type passfail struct {
+	Pass int `json:"pass"`
+	Fail int `json:"fail"`
+}
+
+// report is the machine readable summary of a run.
+type report struct {
+	Tool      string               `json:"tool"`
+	Seed      int                  `json:"seed"`
+	Repeat    int                  `json:"repeat"`
+	Count     int                  `json:"count"`
+	Elapsed   float64              `json:"elapsed"` // in seconds
+	Configs   map[string]int       `json:"configs"`
+	Types     map[string]int       `json:"types"`
+	Pipelines map[string]*passfail `json:"pipelines"`
+	Runs      []pipelinerun        `json:"runs"`
+	Failures  []failcase           `json:"failures"`
+}
+
+func makeReport(elapsed time.Duration) *report {
+	statmu.Lock()
+	defer statmu.Unlock()
+
+	r := &report{
+		Tool:      "collate_validate",
+		Seed:      options.seed,
+		Repeat:    options.repeat,
+		Count:     options.count,
+		Elapsed:   elapsed.Seconds(),
+		Configs:   map[string]int{},
+		Types:     map[string]int{},
+		Pipelines: map[string]*passfail{},
+		Runs:      append([]pipelinerun{}, runs...),
+		Failures:  append([]failcase{}, failures...),
+	}
+	for typ, n := range typecounts {
+		r.Types[typ] = n
+	}
+	for _, run := range runs {
+		p := run.Params
+		r.Configs["numberkind:"+p.NumberKind]++
+		r.Configs["spacekind:"+p.SpaceKind]++
+		r.Configs["container:"+p.Container]++
+		r.Configs[fmt.Sprintf("arraylenprefix:%v", p.ArrayLen)]++
+		r.Configs[fmt.Sprintf("propertylenprefix:%v", p.PropertyLen)]++
+		r.Configs[fmt.Sprintf("missing:%v", p.Missing)]++
+		r.Configs[fmt.Sprintf("strict:%v", p.Strict)]++
+
+		pf, ok := r.Pipelines[run.Pipeline]
+		if !ok {
+			pf = &passfail{}
+			r.Pipelines[run.Pipeline] = pf
+		}
+		if run.Error != "" {
+			pf.Fail++
+		} else {
+			pf.Pass++
+		}
+	}
+	return r
+}
+
+// writeReport write run report as "json" or "junit" xml into filename.
+func writeReport(kind, filename string, elapsed time.Duration) {
+	r := makeReport(elapsed)
+
+	var data []byte
+	var err error
+	switch kind {
+	case "json":
+		if filename == "" {
+			filename = "report.json"
+		}
+		data, err = json.MarshalIndent(r, "", "  ")
+	case "junit":
+		if filename == "" {
+			filename = "report.xml"
+		}
+		data, err = xml.MarshalIndent(r.junit(), "", "  ")
+		data = append([]byte(xml.Header), data...)
+	default:
+		log.Fatalf("unknown report %q, expected json or junit", kind)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("report    : %v\n", filename)
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       float64         `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string         `xml:"name,attr"`
+	Classname string         `xml:"classname,attr"`
+	Time      float64        `xml:"time,attr"`
+	Failures  []junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junit report has a testcase for every pipeline run, named after the
+// pipeline and classified by its seed.
+func (r *report) junit() junitSuites {
+	suite := junitSuite{Name: r.Tool, Time: r.Elapsed}
+	suite.Properties = []junitProperty{
+		{"seed", fmt.Sprint(r.Seed)},
+		{"repeat", fmt.Sprint(r.Repeat)},
+		{"count", fmt.Sprint(r.Count)},
+	}
+	for _, run := range r.Runs {
+		tc := junitCase{
+			Name:      run.Pipeline,
+			Classname: fmt.Sprintf("%v.seed%v", r.Tool, run.Seed),
+			Time:      run.Collate + run.Sortjson + run.Sortbytes,
+		}
+		if run.Error != "" {
+			text := fmt.Sprintf("config: %v", run.Config)
+			for _, fc := range r.Failures {
+				if fc.Seed == run.Seed && fc.Pipeline == run.Pipeline {
+					data, _ := json.Marshal(fc.Inputs)
+					text += fmt.Sprintf("\ninputs: %s", data)
+				}
+			}
+			tc.Failures = append(tc.Failures, junitFailure{run.Error, text})
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	return junitSuites{Suites: []junitSuite{suite}}
+}
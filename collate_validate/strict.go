@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+import "io/ioutil"
+import "log"
+import "runtime"
+import "strings"
+
+// validateStrict collate every line in filename, that are valid JSON in
+// lenient mode but invalid in strict mode, with every pipeline. Strict
+// configs must reject the line with an error and lenient configs must
+// collate it. Return true if any of them fail.
+func validateStrict(filename string) (failed bool) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		for _, nk := range []string{"float", "smart"} {
+			for _, strict := range []bool{false, true} {
+				params := cfgparams{
+					NumberKind: nk, SpaceKind: "ansi", Container: "stream",
+					Strict: strict,
+				}
+				config := params.config()
+				for _, pl := range pipelines {
+					outcome := strictOutcome(pl.collate(config), line)
+					if (strict && outcome == "error") ||
+						(!strict && outcome == "accepted") {
+						continue
+					}
+					fmsg := "strict    : %v %q under %v: %v\n"
+					fmt.Printf(fmsg, pl.name, line, config, outcome)
+					failed = true
+				}
+			}
+		}
+	}
+	if !failed {
+		fmt.Printf("strict    : %v ... ok\n", filename)
+	}
+	return failed
+}
+
+// strictOutcome of collating line, "accepted", "error" for errors
+// raised by gson, or the golang runtime error.
+func strictOutcome(collate collatefn, line string) (outcome string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(runtime.Error); ok {
+				outcome = fmt.Sprintf("panic: %v", err)
+				return
+			}
+			outcome = "error"
+		}
+	}()
+	collate([]byte(line))
+	return "accepted"
+}
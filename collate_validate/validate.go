@@ -14,15 +14,30 @@ import "path"
 import "runtime"
 
 import "github.com/bnclabs/gson"
+import "github.com/bnclabs/gson-tools/internal/structdiff"
 
 var options struct {
-	repeat   int
-	count    int
-	seed     int
-	prodfile string
+	repeat     int
+	count      int
+	seed       int
+	prodfile   string
+	corpus     string
+	replay     string
+	golden     string
+	update     bool
+	strict     string
+	report     string
+	reportfile string
+	pairs      int
+	laws       int
+	missing    bool
 }
 
 func argParse() []string {
+	// failures are saved next to the source, irrespective of cwd.
+	_, filename, _, _ := runtime.Caller(0)
+	corpusdir := path.Join(path.Dir(filename), "corpus")
+
 	flag.IntVar(&options.repeat, "repeat", 1,
 		"number of times to repeat the sort")
 	flag.IntVar(&options.count, "count", 1,
@@ -31,6 +46,26 @@ func argParse() []string {
 		"random seed to monster")
 	flag.StringVar(&options.prodfile, "prodfile", "",
 		"random seed to monster")
+	flag.StringVar(&options.corpus, "corpus", corpusdir,
+		"directory to save failing inputs, empty string to disable")
+	flag.StringVar(&options.replay, "replay", "",
+		"replay failures saved in corpus directory or file")
+	flag.StringVar(&options.golden, "golden", "",
+		"validate collation order with golden files in directory")
+	flag.BoolVar(&options.update, "update", false,
+		"regenerate .ref files with -golden")
+	flag.StringVar(&options.strict, "strict", "",
+		"check strict configs reject and lenient configs accept lines in file")
+	flag.StringVar(&options.report, "report", "",
+		"write run report as \"json\" or \"junit\" xml")
+	flag.StringVar(&options.reportfile, "reportfile", "",
+		"file to write run report, default report.json or report.xml")
+	flag.IntVar(&options.pairs, "pairs", 1000,
+		"number of random pairs to check per pipeline, 0 to disable")
+	flag.IntVar(&options.laws, "laws", 100,
+		"number of random triples to check per config, 0 to disable")
+	flag.BoolVar(&options.missing, "missing", false,
+		"validate collation of Missing with -count generated values")
 	flag.Parse()
 
 	if options.seed == 0 {
@@ -38,7 +73,6 @@ func argParse() []string {
 	}
 
 	if options.prodfile == "" {
-		_, filename, _, _ := runtime.Caller(0)
 		options.prodfile = path.Join(path.Dir(filename), "json.prod")
 	}
 
@@ -47,148 +81,194 @@ func argParse() []string {
 
 func main() {
 	argParse()
+	if options.golden != "" {
+		if validateGolden(options.golden, options.update) {
+			os.Exit(1)
+		}
+		return
+	} else if options.strict != "" {
+		if validateStrict(options.strict) {
+			os.Exit(1)
+		}
+		return
+	} else if options.missing {
+		if validateMissing(options.seed, options.count) {
+			os.Exit(1)
+		}
+		return
+	} else if options.replay != "" {
+		if replayCorpus(options.replay) {
+			os.Exit(1)
+		}
+		return
+	}
+	start, failed := time.Now(), false
 	for i := 0; i < options.repeat; i++ {
-		collateValidate(options.seed + i)
+		if failed = collateValidate(options.seed + i); failed {
+			break
+		}
 		fmt.Println()
 	}
-}
-
-func collateValidate(seed int) {
-	count1to4 := options.count / 5
-	count5 := options.count - (count1to4 * 4)
-	fmt.Printf("seed      : %v\n", seed)
-	fmt.Printf("items     : %v %v %v\n", options.count, count1to4, count5)
-
-	generate := func(ch chan string) {
-		generateInteger(seed, count1to4, ch)
-		generateSD(seed, count1to4, ch)
-		generateLD(seed, count1to4, ch)
-		generateFloats(seed, count1to4, ch)
-		generateJSON(options.prodfile, seed, count5, ch)
+	if options.report != "" {
+		writeReport(options.report, options.reportfile, time.Since(start))
 	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
-	var wg sync.WaitGroup
-	wg.Add(5)
-
-	go func() {
-		mrand := rand.New(rand.NewSource(int64(seed)))
-		config := makeConfig(mrand)
-		ch := make(chan string, 1000)
-		go func() { generate(ch); close(ch) }()
-		validateWith(
-			config,
-			"JsonToValueToCborToCollate",
-			options.count,
-			ch,
-			func(input []byte) []byte {
-				cbr := config.NewCbor(make([]byte, 0, 1024))
-				clt := config.NewCollate(make([]byte, 0, 1024))
-				_, value := config.NewJson(input).Tovalue()
-				return config.NewValue(value).Tocbor(cbr).Tocollate(clt).Bytes()
-			})
-		wg.Done()
-	}()
-
-	go func() { // JsonToValueToCollate
-		mrand := rand.New(rand.NewSource(int64(seed)))
-		config := makeConfig(mrand)
-		ch := make(chan string, 1000)
-		go func() { generate(ch); close(ch) }()
-		validateWith(
-			config,
-			"JsonToValueToCollate",
-			options.count,
-			ch,
-			func(input []byte) []byte {
-				clt := config.NewCollate(make([]byte, 0, 1024))
-				_, value := config.NewJson(input).Tovalue()
-				return config.NewValue(value).Tocollate(clt).Bytes()
-			})
-		wg.Done()
-	}()
-
-	go func() { // JsonToCollate
-		mrand := rand.New(rand.NewSource(int64(seed)))
-		config := makeConfig(mrand)
-		ch := make(chan string, 1000)
-		go func() { generate(ch); close(ch) }()
-		validateWith(
-			config,
-			"JsonToCollate",
-			options.count,
-			ch,
-			func(input []byte) []byte {
-				clt := config.NewCollate(make([]byte, 0, 1024))
-				return config.NewJson(input).Tocollate(clt).Bytes()
-			})
-		wg.Done()
-	}()
+// pipelines collate JSON input in different ways, the collated
+// output from every pipeline must sort the same as JSON input.
+var pipelines = []struct {
+	name    string
+	collate func(config *gson.Config) collatefn
+}{
+	{"JsonToValueToCborToCollate", func(config *gson.Config) collatefn {
+		return func(input []byte) []byte {
+			cbr := config.NewCbor(make([]byte, 0, 1024))
+			clt := config.NewCollate(make([]byte, 0, 1024))
+			_, value := config.NewJson(input).Tovalue()
+			return config.NewValue(value).Tocbor(cbr).Tocollate(clt).Bytes()
+		}
+	}},
+	{"JsonToValueToCollate", func(config *gson.Config) collatefn {
+		return func(input []byte) []byte {
+			clt := config.NewCollate(make([]byte, 0, 1024))
+			_, value := config.NewJson(input).Tovalue()
+			return config.NewValue(value).Tocollate(clt).Bytes()
+		}
+	}},
+	{"JsonToCollate", func(config *gson.Config) collatefn {
+		return func(input []byte) []byte {
+			clt := config.NewCollate(make([]byte, 0, 1024))
+			return config.NewJson(input).Tocollate(clt).Bytes()
+		}
+	}},
+	{"JsonToCborToValueToCollate", func(config *gson.Config) collatefn {
+		return func(input []byte) []byte {
+			cbr := config.NewCbor(make([]byte, 0, 1024))
+			clt := config.NewCollate(make([]byte, 0, 1024))
+			value := config.NewJson(input).Tocbor(cbr).Tovalue()
+			return config.NewValue(value).Tocollate(clt).Bytes()
+		}
+	}},
+	{"JsonToCborToCollate", func(config *gson.Config) collatefn {
+		return func(input []byte) []byte {
+			cbr := config.NewCbor(make([]byte, 0, 1024))
+			clt := config.NewCollate(make([]byte, 0, 1024))
+			config.NewJson(input).Tocbor(cbr)
+			return cbr.Tocollate(clt).Bytes()
+		}
+	}},
+}
 
-	go func() {
-		mrand := rand.New(rand.NewSource(int64(seed)))
-		config := makeConfig(mrand)
-		ch := make(chan string, 1000)
-		go func() { generate(ch); close(ch) }()
-		validateWith(
-			config,
-			"JsonToCborToValueToCollate",
-			options.count,
-			ch,
-			func(input []byte) []byte {
-				cbr := config.NewCbor(make([]byte, 0, 1024))
-				clt := config.NewCollate(make([]byte, 0, 1024))
-				value := config.NewJson(input).Tocbor(cbr).Tovalue()
-				return config.NewValue(value).Tocollate(clt).Bytes()
-			})
-		wg.Done()
-	}()
+func collateValidate(seed int) (failed bool) {
+	count1to5 := options.count / 6
+	count6 := options.count - (count1to5 * 5)
+	fmt.Printf("seed      : %v\n", seed)
+	fmt.Printf("items     : %v %v %v\n", options.count, count1to5, count6)
 
+	ch := make(chan string, 1000)
 	go func() {
-		mrand := rand.New(rand.NewSource(int64(seed)))
-		config := makeConfig(mrand)
-		ch := make(chan string, 1000)
-		go func() { generate(ch); close(ch) }()
-		validateWith(
-			config,
-			"JsonToCborToCollate",
-			options.count,
-			ch,
-			func(input []byte) []byte {
-				cbr := config.NewCbor(make([]byte, 0, 1024))
-				clt := config.NewCollate(make([]byte, 0, 1024))
-				config.NewJson(input).Tocbor(cbr)
-				return cbr.Tocollate(clt).Bytes()
-			})
-		wg.Done()
+		generateInteger(seed, count1to5, ch)
+		generateSD(seed, count1to5, ch)
+		generateLD(seed, count1to5, ch)
+		generateFloats(seed, count1to5, ch)
+		generateLengths(seed, count1to5, ch)
+		generateJSON(options.prodfile, seed, count6, ch)
+		close(ch)
 	}()
+	inputs := make([]string, 0, options.count)
+	for input := range ch {
+		inputs = append(inputs, input)
+		booktype(input)
+	}
 
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wg.Add(len(pipelines))
+	for _, pl := range pipelines {
+		go func(name string, collate func(*gson.Config) collatefn) {
+			defer wg.Done()
+			mrand := rand.New(rand.NewSource(int64(seed)))
+			config, params := makeConfig(mrand)
+			fn := collate(config)
+			run, err := validateWith(params, name, inputs, fn)
+			run.Seed, run.Params = seed, params
+			if err != nil {
+				bookrun(run)
+				fc := failcase{
+					Seed: seed, Config: params, Pipeline: name,
+					Inputs: inputs,
+				}
+				saveFailure(fc, err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				return
+			}
+			npairs := options.pairs
+			pair, err := validatePairs(config, name, inputs, fn, mrand, npairs)
+			if run.Pairs = npairs; err != nil {
+				run.Error = err.Error()
+			}
+			bookrun(run)
+			if err != nil {
+				fc := failcase{
+					Seed: seed, Config: params, Pipeline: name,
+					Check: "pairs", Inputs: pair,
+				}
+				saveFailure(fc, err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(pl.name, pl.collate)
+	}
 	wg.Wait()
+	if options.laws > 0 && validateLaws(seed, inputs, options.laws) {
+		failed = true
+	}
+	return failed
 }
 
+// collatefn collate JSON input into binary collation.
+type collatefn func(input []byte) []byte
+
 func validateWith(
-	config *gson.Config, nm string, count int, ch chan string,
-	fn func([]byte) []byte) {
+	params cfgparams, nm string, inputs []string,
+	fn collatefn) (run pipelinerun, err error) {
 
 	var input string
+	config := params.config()
 
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Printf("panic recovered: %v\n", r)
 			fmt.Printf("%v", getStackTrace(2, debug.Stack()))
 			fmt.Printf("json : %q\n", input)
+			err = fmt.Errorf("%v", r)
+		}
+		if err != nil {
+			run.Error = err.Error()
 		}
 	}()
 
-	inputs := make([]string, 0, count)
+	count := len(inputs)
+	run = pipelinerun{Pipeline: nm, Config: config.String(), Items: count}
 	collated := make([][]byte, 0, count)
-	for input = range ch {
-		inputs = append(inputs, input)
-		collated = append(collated, fn([]byte(input)))
-	}
+	collts := timeIt(func() {
+		for _, input = range inputs {
+			collated = append(collated, fn([]byte(input)))
+		}
+	})
 
-	rawlist := &jsonList{config: config, vals: inputs, compares: 0}
+	vals := append([]string{}, inputs...)
+	rawlist := &jsonList{config: config, vals: vals, compares: 0}
 	rawts := timeIt(func() { sort.Sort(rawlist) })
 	bints := timeIt(func() { sort.Sort(byteSlices(collated)) })
+	run.Collate, run.Sortjson = collts.Seconds(), rawts.Seconds()
+	run.Sortbytes, run.Compares = bints.Seconds(), rawlist.compares
 	fmt.Printf("config: %v\n", config.String())
 	fmsg := "%-30v: %v Vs %v %v compares\n"
 	fmt.Printf(fmsg, nm, rawts, bints, rawlist.compares)
@@ -210,79 +290,88 @@ func validateWith(
 	}
 
 	// check
-	exit := false
 	if n, m := len(values), len(refs); n != m {
 		fmt.Printf("expected %v, got %v\n", m, n)
-		exit = true
+		err = fmt.Errorf("%v: expected %v items, got %v", nm, m, n)
 	}
 	for i, ref := range refs {
 		val := config.NewValue(values[i])
 		refval := config.NewValue(ref)
 		if refval.Compare(val) != 0 {
-			fmt.Printf("index %v expected %T, got %T\n", i, ref, values[i])
-			exit = true
+			diff := structdiff.Diff(config, ref, values[i])
+			fmt.Printf("index %v %v\n", i, diff)
+			err = fmt.Errorf("%v: mismatch at index %v, %v", nm, i, diff)
 		}
 	}
-	if exit {
-		os.Exit(1)
+
+	// check both sorts with the reference order, that trusts no gson.
+	order := refOrderOf(params)
+	for _, sorted := range []struct {
+		what   string
+		values []interface{}
+	}{{"Value.Compare sort", refs}, {"collated sort", values}} {
+		if oerr := order.checkSorted(sorted.what, sorted.values); oerr != nil {
+			fmt.Printf("oracle: %v\n", oerr)
+			err = fmt.Errorf("%v: %v", nm, oerr)
+		}
 	}
+	return run, err
 }
 
-func makeConfig(mrand *rand.Rand) *gson.Config {
-	config := gson.NewDefaultConfig()
+// cfgparams are the choices that make up a gson.Config, unlike
+// gson.Config they can be saved along with a failure and rebuilt.
+type cfgparams struct {
+	NumberKind  string `json:"numberkind"`
+	SpaceKind   string `json:"spacekind"`
+	Container   string `json:"container"`
+	ArrayLen    bool   `json:"arraylenprefix"`
+	Missing     bool   `json:"missing"`
+	Strict      bool   `json:"strict"`
+	PropertyLen bool   `json:"propertylenprefix"`
+}
+
+func makeConfig(mrand *rand.Rand) (*gson.Config, cfgparams) {
 	nks := []string{"float", "smart"}
-	nk := nks[mrand.Intn(len(nks))]
-	switch nk {
+	wss := []string{"ansi", "unicode"}
+	cts := []string{"lenprefix", "stream"}
+	bools := []bool{true, false}
+
+	params := cfgparams{
+		NumberKind:  nks[mrand.Intn(len(nks))],
+		SpaceKind:   wss[mrand.Intn(len(wss))],
+		Container:   cts[mrand.Intn(len(cts))],
+		ArrayLen:    bools[mrand.Intn(2)],
+		Missing:     bools[mrand.Intn(2)],
+		Strict:      bools[mrand.Intn(2)],
+		PropertyLen: bools[mrand.Intn(2)],
+	}
+	return params.config(), params
+}
+
+// config build gson.Config from params.
+func (params cfgparams) config() *gson.Config {
+	config := gson.NewDefaultConfig()
+	switch params.NumberKind {
 	case "smart":
 		config = config.SetNumberKind(gson.SmartNumber)
-		//incrparam("SmartNumber", 1)
 	case "float":
 		config = config.SetNumberKind(gson.FloatNumber)
-		//incrparam("FloatNumber", 1)
 	}
-
-	wss := []string{"ansi", "unicode"}
-	ws := wss[mrand.Intn(len(wss))]
-	switch ws {
+	switch params.SpaceKind {
 	case "ansi":
 		config = config.SetSpaceKind(gson.AnsiSpace)
-		//incrparam("AnsiSpace", 1)
 	case "unicode":
 		config = config.SetSpaceKind(gson.UnicodeSpace)
-		//incrparam("UnicodeSpace", 1)
 	}
-
-	cts := []string{"lenprefix", "stream"}
-	ct := cts[mrand.Intn(len(cts))]
-	switch ct {
+	switch params.Container {
 	case "lenprefix":
 		config = config.SetContainerEncoding(gson.LengthPrefix)
-		//incrparam("LengthPrefix", 1)
 	case "stream":
 		config = config.SetContainerEncoding(gson.Stream)
-		//incrparam("Stream", 1)
-	}
-
-	bools := []bool{true, false}
-
-	sortbyarraylen := bools[mrand.Intn(2)]
-	config = config.SortbyArrayLen(sortbyarraylen)
-	//if sortbyarraylen {
-	//	incrparam("arrayLenPrefix", 1)
-	//}
-	//if sortbyproplen {
-	//	incrparam("propertyLenPrefix", 1)
-	//}
-
-	missing := bools[mrand.Intn(2)]
-	config = config.UseMissing(missing).SetStrict(false)
-	if missing {
-		//incrparam("doMissing", 1)
 	}
-	//if strict {
-	//	incrparam("strict", 1)
-	//}
-	return config
+	config = config.SortbyArrayLen(params.ArrayLen)
+	config = config.SortbyPropertyLen(params.PropertyLen)
+	return config.UseMissing(params.Missing).SetStrict(params.Strict)
 }
 
 func timeIt(fn func()) time.Duration {
@@ -0,0 +1,110 @@
+// Package structdiff locate the first difference between two JSON
+// documents, shared by validate and collate_validate.
+package structdiff
+
+import "fmt"
+import "sort"
+import "strconv"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// Diff return the first JSON pointer, in document order, at which
+// value differs from ref along with both sub-values and their types,
+// like "/a/3/b: float64(1.5) vs uint64(1)". Numbers that are equal but
+// held in different golang kinds are reported only if nothing else
+// differs. Return empty string if no difference is found.
+func Diff(config *gson.Config, ref, value interface{}) string {
+	refval, val := config.NewValue(ref), config.NewValue(value)
+	inref, inval := map[string]bool{"": true}, map[string]bool{"": true}
+	pointers := []string{""}
+	for _, ptr := range refval.ListPointers([]string{}) {
+		if !inref[ptr] {
+			inref[ptr] = true
+			pointers = append(pointers, ptr)
+		}
+	}
+	for _, ptr := range val.ListPointers([]string{}) {
+		if !inval[ptr] {
+			inval[ptr] = true
+			if !inref[ptr] {
+				pointers = append(pointers, ptr)
+			}
+		}
+	}
+	sort.Slice(pointers, func(i, j int) bool {
+		return pointerLess(pointers[i], pointers[j])
+	})
+
+	kindonly := ""
+	for _, ptr := range pointers {
+		if strings.HasSuffix(ptr, "/-") {
+			continue
+		}
+		a, b := "<missing>", "<missing>"
+		var x, y interface{}
+		if inref[ptr] {
+			x = pointerGet(config, refval, ptr)
+			a = describe(x)
+		}
+		if inval[ptr] {
+			y = pointerGet(config, val, ptr)
+			b = describe(y)
+		}
+		if !inref[ptr] || !inval[ptr] || differs(config, x, y) {
+			return fmt.Sprintf("%v: %v vs %v", ptr, a, b)
+		}
+		if kindonly == "" && fmt.Sprintf("%T", x) != fmt.Sprintf("%T", y) {
+			kindonly = fmt.Sprintf("%v: %v vs %v", ptr, a, b)
+		}
+	}
+	return kindonly
+}
+
+func pointerGet(config *gson.Config, val *gson.Value, ptr string) interface{} {
+	if ptr == "" {
+		return val.Data()
+	}
+	return val.Get(config.NewJsonpointer(ptr))
+}
+
+// differs compare scalars, containers differ only if their types
+// differ, their items are compared on their own pointers.
+func differs(config *gson.Config, x, y interface{}) bool {
+	_, xarr := x.([]interface{})
+	_, yarr := y.([]interface{})
+	_, xmap := x.(map[string]interface{})
+	_, ymap := y.(map[string]interface{})
+	if xarr || yarr || xmap || ymap {
+		return xarr != yarr || xmap != ymap
+	}
+	return config.NewValue(x).Compare(config.NewValue(y)) != 0
+}
+
+func describe(v interface{}) string {
+	switch x := v.(type) {
+	case []interface{}:
+		return fmt.Sprintf("%T(len %v)", x, len(x))
+	case map[string]interface{}:
+		return fmt.Sprintf("%T(len %v)", x, len(x))
+	}
+	return fmt.Sprintf("%T(%v)", v, v)
+}
+
+// pointerLess order pointers in document order, array indices are
+// compared as numbers.
+func pointerLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, xerr := strconv.Atoi(as[i])
+		y, yerr := strconv.Atoi(bs[i])
+		if xerr == nil && yerr == nil {
+			return x < y
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
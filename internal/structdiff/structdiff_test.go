@@ -0,0 +1,69 @@
+package structdiff
+
+import "sort"
+import "testing"
+
+import "github.com/bnclabs/gson"
+
+func TestPointerLess(t *testing.T) {
+	pointers := []string{"/b", "/a/10", "", "/a/2/x", "/a/2", "/a"}
+	sort.Slice(pointers, func(i, j int) bool {
+		return pointerLess(pointers[i], pointers[j])
+	})
+	refs := []string{"", "/a", "/a/2", "/a/2/x", "/a/10", "/b"}
+	for i, ref := range refs {
+		if pointers[i] != ref {
+			t.Errorf("expected %v, got %v", refs, pointers)
+			break
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	config := gson.NewDefaultConfig()
+	testcases := []struct {
+		ref, value interface{}
+		diff       string
+	}{
+		{ // equal
+			map[string]interface{}{"a": []interface{}{1.0, "x"}},
+			map[string]interface{}{"a": []interface{}{1.0, "x"}},
+			"",
+		},
+		{ // nested value mismatch
+			map[string]interface{}{
+				"a": []interface{}{1.0, map[string]interface{}{"b": "x"}},
+			},
+			map[string]interface{}{
+				"a": []interface{}{1.0, map[string]interface{}{"b": "y"}},
+			},
+			"/a/1/b: string(x) vs string(y)",
+		},
+		{ // kind mismatch
+			[]interface{}{float64(1)},
+			[]interface{}{uint64(1)},
+			"/0: float64(1) vs uint64(1)",
+		},
+		{ // value mismatch is reported ahead of kind mismatch
+			map[string]interface{}{"a": float64(1), "b": "x"},
+			map[string]interface{}{"a": uint64(1), "b": "y"},
+			"/b: string(x) vs string(y)",
+		},
+		{ // pointer present on one side only
+			map[string]interface{}{"a": 1.0},
+			map[string]interface{}{"a": 1.0, "b": true},
+			"/b: <missing> vs bool(true)",
+		},
+		{ // scalar root vs container root
+			"x",
+			[]interface{}{"x"},
+			": string(x) vs []interface {}(len 1)",
+		},
+	}
+	for _, tcase := range testcases {
+		if diff := Diff(config, tcase.ref, tcase.value); diff != tcase.diff {
+			t.Errorf("%v vs %v: expected %q, got %q",
+				tcase.ref, tcase.value, tcase.diff, diff)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import "encoding/json"
+import "fmt"
+import "math"
+import "math/big"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+// cborError is a non-conformance found by the reference decoder.
+type cborError string
+
+func (err cborError) Error() string {
+	return string(err)
+}
+
+// cborDecoder is a reference RFC 8949 decoder, sharing no code with
+// gson. It decodes into the same types encoding/json decodes to, with
+// numbers as json.Number, so that its output can be compared using
+// diffJSON. container is the gson container encoding the input was
+// produced with, "lenprefix" expects definite length arrays and maps
+// while "stream" expects indefinite length arrays and maps.
+type cborDecoder struct {
+	data      []byte
+	off       int
+	container string
+}
+
+// cborDecode decode exactly one data item from data.
+func cborDecode(data []byte, container string) (val interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if cerr, ok := r.(cborError); ok {
+				val, err = nil, cerr
+				return
+			}
+			panic(r)
+		}
+	}()
+	d := &cborDecoder{data: data, container: container}
+	val = d.item()
+	if d.off != len(data) {
+		d.fail("%v trailing bytes", len(data)-d.off)
+	}
+	return val, nil
+}
+
+func (d *cborDecoder) fail(fmsg string, args ...interface{}) {
+	msg := fmt.Sprintf(fmsg, args...)
+	panic(cborError(fmt.Sprintf("%v at offset %v", msg, d.off)))
+}
+
+func (d *cborDecoder) read(n uint64) []byte {
+	if n > uint64(len(d.data)-d.off) {
+		d.fail("truncated, need %v bytes", n)
+	}
+	out := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return out
+}
+
+func (d *cborDecoder) uint(n uint64) (arg uint64) {
+	for _, b := range d.read(n) {
+		arg = arg<<8 | uint64(b)
+	}
+	return arg
+}
+
+// head decode the initial byte and its argument, indefinite is true
+// for additional information 31.
+func (d *cborDecoder) head() (major, info byte, arg uint64, indefinite bool) {
+	b := d.read(1)[0]
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg = d.uint(1 << (info - 24))
+	case info < 31:
+		d.fail("reserved additional information %v", info)
+	default:
+		indefinite = true
+	}
+	return major, info, arg, indefinite
+}
+
+// isbreak consume the break code if it is next.
+func (d *cborDecoder) isbreak() bool {
+	if d.off >= len(d.data) {
+		d.fail("truncated, missing break")
+	} else if d.data[d.off] == 0xff {
+		d.off++
+		return true
+	}
+	return false
+}
+
+// count check that n items, each at least a byte, can fit in input.
+func (d *cborDecoder) count(n uint64, what string) {
+	if n > uint64(len(d.data)-d.off) {
+		d.fail("%v length %v exceeds input", what, n)
+	}
+}
+
+func (d *cborDecoder) item() interface{} {
+	major, info, arg, indefinite := d.head()
+	if indefinite && (major == 0 || major == 1 || major == 6) {
+		d.fail("indefinite length for major type %v", major)
+	}
+	switch major {
+	case 0:
+		return json.Number(strconv.FormatUint(arg, 10))
+	case 1:
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Neg(n.Add(n, big.NewInt(1))).String())
+	case 2, 3:
+		var s []byte
+		if !indefinite {
+			s = d.read(arg)
+		}
+		for indefinite && !d.isbreak() { // chunks
+			cmajor, _, carg, cindefinite := d.head()
+			if cmajor != major || cindefinite {
+				d.fail("invalid chunk of major type %v", cmajor)
+			}
+			s = append(s, d.read(carg)...)
+		}
+		if major == 2 {
+			return s
+		} else if !utf8.Valid(s) {
+			d.fail("invalid utf8 in text string")
+		}
+		return string(s)
+	case 4:
+		d.checkcontainer("array", indefinite)
+		arr := []interface{}{}
+		if indefinite {
+			for !d.isbreak() {
+				arr = append(arr, d.item())
+			}
+			return arr
+		}
+		d.count(arg, "array")
+		for i := uint64(0); i < arg; i++ {
+			arr = append(arr, d.item())
+		}
+		return arr
+	case 5:
+		d.checkcontainer("map", indefinite)
+		m := map[string]interface{}{}
+		if indefinite {
+			for !d.isbreak() {
+				d.property(m)
+			}
+			return m
+		}
+		d.count(arg, "map")
+		for i := uint64(0); i < arg; i++ {
+			d.property(m)
+		}
+		return m
+	case 6:
+		content := d.item()
+		if arg == 2 || arg == 3 { // bignum
+			b, ok := content.([]byte)
+			if !ok {
+				d.fail("bignum tag %v on %T", arg, content)
+			}
+			n := new(big.Int).SetBytes(b)
+			if arg == 3 {
+				n.Neg(n.Add(n, big.NewInt(1)))
+			}
+			return json.Number(n.String())
+		}
+		return content
+	}
+	return d.simple(info, arg)
+}
+
+func (d *cborDecoder) checkcontainer(what string, indefinite bool) {
+	if indefinite && d.container == "lenprefix" {
+		d.fail("indefinite length %v under lenprefix", what)
+	} else if !indefinite && d.container == "stream" {
+		d.fail("definite length %v under stream", what)
+	}
+}
+
+// property decode a key and its value into m. A duplicate key comes
+// from the input itself, the last value wins, as with encoding/json.
+func (d *cborDecoder) property(m map[string]interface{}) {
+	key, ok := d.item().(string)
+	if !ok {
+		d.fail("map key is not a text string")
+	}
+	m[key] = d.item()
+}
+
+// simple decode major type 7, floating point and simple values.
+func (d *cborDecoder) simple(info byte, arg uint64) interface{} {
+	var f float64
+	switch info {
+	case 20:
+		return false
+	case 21:
+		return true
+	case 22:
+		return nil
+	case 24:
+		if arg < 32 {
+			d.fail("invalid two byte simple value %v", arg)
+		}
+		d.fail("unassigned simple value %v", arg)
+	case 25:
+		f = halffloat(uint16(arg))
+	case 26:
+		f = float64(math.Float32frombits(uint32(arg)))
+	case 27:
+		f = math.Float64frombits(arg)
+	case 31:
+		d.fail("break outside indefinite length item")
+	default:
+		d.fail("unassigned simple value %v", arg)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		d.fail("%v is not a JSON number", f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// halffloat decode IEEE 754 half precision, as in RFC 8949 Appendix D.
+func halffloat(half uint16) float64 {
+	exp, mant := int(half>>10)&0x1f, float64(half&0x3ff)
+	var val float64
+	switch exp {
+	case 0:
+		val = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			val = math.Inf(1)
+		} else {
+			val = math.NaN()
+		}
+	default:
+		val = math.Ldexp(mant+1024, exp-25)
+	}
+	if half&0x8000 != 0 {
+		return -val
+	}
+	return val
+}
+
+// cborchains produce cbor from input JSON text.
+var cborchains = []string{"json2cbor", "json2value2cbor", "json2collate2cbor"}
+
+// verifyCborReference decode cbor produced by gson, under both
+// container encodings, with the reference decoder and compare it with
+// the reference value. Chains failing within gson are reported by
+// walkTransforms and skipped here.
+func verifyCborReference(params cfgparams, input string) error {
+	for _, container := range []string{"lenprefix", "stream"} {
+		p := params
+		p.Container = container
+		config := p.config()
+		for _, name := range cborchains {
+			c, err := parseChain(name)
+			if err != nil {
+				return err
+			}
+			out, err := applyChain(config, []byte(input), c)
+			if err != nil {
+				continue
+			}
+			ref, data := reference(config, []byte(input)), out.cbr.Bytes()
+			val, err := cborDecode(data, container)
+			if err != nil {
+				fmsg := "%v under %v: %v, cbor %x"
+				return fmt.Errorf(fmsg, name, container, err, data)
+			}
+			diffs := diffJSON(p, "", ref, val, nil)
+			if len(diffs) == 0 {
+				continue
+			}
+			lines := []string{}
+			for _, d := range diffs {
+				fmsg := "%v %q: gson %v, reference %v"
+				line := fmt.Sprintf(fmsg, d.Kind, d.Pointer, d.Gson, d.Stdlib)
+				lines = append(lines, line)
+			}
+			fmsg := "%v under %v, cbor %x:\n  %v"
+			return fmt.Errorf(fmsg, name, container, data,
+				strings.Join(lines, "\n  "))
+		}
+	}
+	verbosef("verifyCborReference ... ok\n")
+	return nil
+}
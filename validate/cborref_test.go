@@ -0,0 +1,68 @@
+package main
+
+import "encoding/hex"
+import "encoding/json"
+import "reflect"
+import "strings"
+import "testing"
+
+func TestCborDecode(t *testing.T) {
+	testcases := []struct {
+		hex, container string
+		ref            interface{}
+	}{
+		{"00", "", json.Number("0")},
+		{"3bffffffffffffffff", "", json.Number("-18446744073709551616")},
+		{"f93c00", "", json.Number("1")},
+		{"f9c400", "", json.Number("-4")},
+		{"fb3ff199999999999a", "", json.Number("1.1")},
+		{"7f657374726561646d696e67ff", "", "streaming"},
+		{"c249010000000000000000", "", json.Number("18446744073709551616")},
+		{"83010203", "lenprefix", []interface{}{
+			json.Number("1"), json.Number("2"), json.Number("3"),
+		}},
+		{"9f0102ff", "stream", []interface{}{
+			json.Number("1"), json.Number("2"),
+		}},
+		{"bf61610161629f0203ffff", "stream", map[string]interface{}{
+			"a": json.Number("1"),
+			"b": []interface{}{json.Number("2"), json.Number("3")},
+		}},
+		{"a2616101616102", "lenprefix", map[string]interface{}{
+			"a": json.Number("2"),
+		}},
+	}
+	for _, tcase := range testcases {
+		data, _ := hex.DecodeString(tcase.hex)
+		val, err := cborDecode(data, tcase.container)
+		if err != nil {
+			t.Errorf("%v: %v", tcase.hex, err)
+		} else if !reflect.DeepEqual(val, tcase.ref) {
+			t.Errorf("%v: expected %v, got %v", tcase.hex, tcase.ref, val)
+		}
+	}
+}
+
+func TestCborDecodeInvalid(t *testing.T) {
+	testcases := []struct{ hex, container, err string }{
+		{"1c", "", "reserved additional information"},
+		{"ff", "", "break outside"},
+		{"1f", "", "indefinite length for major type 0"},
+		{"83", "", "exceeds input"},
+		{"9f01", "", "missing break"},
+		{"0000", "", "trailing bytes"},
+		{"7f4100ff", "", "invalid chunk"},
+		{"62c328", "", "invalid utf8"},
+		{"9f01ff", "lenprefix", "indefinite length array under lenprefix"},
+		{"a0", "stream", "definite length map under stream"},
+		{"a10102", "", "map key is not a text string"},
+		{"f97e00", "", "not a JSON number"},
+	}
+	for _, tcase := range testcases {
+		data, _ := hex.DecodeString(tcase.hex)
+		_, err := cborDecode(data, tcase.container)
+		if err == nil || !strings.Contains(err.Error(), tcase.err) {
+			t.Errorf("%v: expected %q, got %v", tcase.hex, tcase.err, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import "crypto/sha1"
+import "encoding/hex"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io/ioutil"
+import "log"
+import "os"
+import "path/filepath"
+import "sort"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// failcase is a failure saved into the corpus directory, it carries
+// enough to re-run the failing check with -replay.
+type failcase struct {
+	Seed   int       `json:"seed"`
+	Config cfgparams `json:"config"`
+	Check  string    `json:"check"`
+	Input  string    `json:"input"`
+	Shrunk string    `json:"shrunk,omitempty"`
+	Error  string    `json:"error"`
+}
+
+// saveFailure save failing check on input into the corpus directory,
+// same failure saved more than once shall land on the same file. Every
+// failure is also remembered for the run report.
+func saveFailure(params cfgparams, check, input, shrunk string, err error) {
+	fc := failcase{
+		Seed: options.seed, Config: params, Check: check,
+		Input: input, Shrunk: shrunk, Error: err.Error(),
+	}
+	statrw.Lock()
+	failures = append(failures, fc)
+	statrw.Unlock()
+
+	if options.corpus == "" {
+		return
+	}
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, _ := json.Marshal([]interface{}{fc.Config, fc.Check, fc.Input})
+	filename := fmt.Sprintf("%v-%x.json", check, sha1.Sum(key))
+	if err := os.MkdirAll(options.corpus, 0755); err != nil {
+		log.Fatal(err)
+	}
+	filename = filepath.Join(options.corpus, filename)
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	write("saved  : %v\n", filename)
+}
+
+// loadCorpus load failures from a corpus file or from every .json
+// file in a corpus directory.
+func loadCorpus(corpus string) ([]string, []failcase) {
+	fi, err := os.Stat(corpus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files := []string{corpus}
+	if fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(corpus, "*.json")); err != nil {
+			log.Fatal(err)
+		}
+		sort.Strings(files)
+	}
+	fcs := make([]failcase, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var fc failcase
+		if err := json.Unmarshal(data, &fc); err != nil {
+			log.Fatalf("%v: %v", file, err)
+		}
+		fcs = append(fcs, fc)
+	}
+	return files, fcs
+}
+
+// replayCorpus re-run every failure in corpus, and check its input
+// against encoding/json, cases that continue to fail are counted as
+// "fail" in statistics.
+func replayCorpus(corpus string) {
+	files, fcs := loadCorpus(corpus)
+	for i, fc := range fcs {
+		err := replayCase(fc)
+		decode := strings.HasPrefix(fc.Check, "decode:")
+		if err == nil && !decode && fc.Check != "stateful" {
+			err = verifyDifferential(fc.Config, fc.Input)
+		}
+		if err != nil {
+			write("replay %v ... fail: %v\n", files[i], err)
+			incrparam("fail", 1)
+			continue
+		}
+		verbosef("replay %v ... ok\n", files[i])
+		incrparam("pass", 1)
+	}
+}
+
+func replayCase(fc failcase) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	config := fc.Config.config()
+	if strings.HasPrefix(fc.Check, "decode:") {
+		return replayDecode(config, strings.TrimPrefix(fc.Check, "decode:"), fc)
+	}
+	switch fc.Check {
+	case "strict":
+		_, err := verifyStrict(fc.Config, fc.Input)
+		return err
+	case "differential":
+		return verifyDifferential(fc.Config, fc.Input)
+	case "cborReference":
+		return verifyCborReference(fc.Config, fc.Input)
+	case "pointerConformance":
+		_, doc := config.NewJson([]byte(fc.Input)).Tovalue()
+		return verifyPointerConformance(fc.Config, doc)
+	case "appendDelete":
+		return verifyAppendDelete(fc.Config, fc.Input)
+	case "stateful":
+		return replayStateful(fc.Config, fc.Input)
+	case "verifyValuePointers":
+		_, doc := config.NewJson([]byte(fc.Input)).Tovalue()
+		return verifyValuePointers(config, doc)
+	case "verifyCborPointers":
+		_, doc := config.NewJson([]byte(fc.Input)).Tovalue()
+		return verifyCborPointers(config, doc)
+	}
+	c, err := parseChain(fc.Check)
+	if err != nil {
+		return err
+	}
+	err = runChain(config, []byte(fc.Input), c)
+	if err != nil && options.trace {
+		printTrace(traceChain(config, []byte(fc.Input), c))
+	}
+	return err
+}
+
+// parseChain is the inverse of chain.String().
+func parseChain(name string) (chain, error) {
+	names := strings.Split(name, "2")
+	if len(names) < 2 || names[0] != reprJSON.String() {
+		return nil, fmt.Errorf("invalid chain %q", name)
+	}
+	c, from := chain{}, reprJSON
+	for _, name := range names[1:] {
+		var next *edge
+		for _, e := range edges {
+			if e.from == from && e.to.String() == name {
+				next = e
+			}
+		}
+		if next == nil {
+			return nil, errors.New("no edge " + from.String() + "2" + name)
+		}
+		c, from = append(c, next), next.to
+	}
+	return c, nil
+}
+
+// replayDecode feed hex encoded input, saved by mutation stage, to the
+// named decoder, anything other than a clean error or a decoded value
+// is a failure.
+func replayDecode(config *gson.Config, name string, fc failcase) error {
+	input, err := hex.DecodeString(fc.Input)
+	if err != nil {
+		return err
+	}
+	for _, dec := range decoders {
+		if dec.name != name {
+			continue
+		}
+		outcome, _ := decodeOutcome(config, dec, input, options.timeout)
+		if outcome != "error" && outcome != "accepted" {
+			return fmt.Errorf("%v: %v", name, outcome)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown decoder %q", name)
+}
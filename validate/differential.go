@@ -0,0 +1,207 @@
+package main
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// jsondiff is a disagreement between gson and encoding/json at a JSON
+// pointer, kind is one of "accept", "type", "value", "key" and
+// "reencode".
+type jsondiff struct {
+	Pointer string `json:"pointer"`
+	Kind    string `json:"kind"`
+	Gson    string `json:"gson"`
+	Stdlib  string `json:"stdlib"`
+}
+
+func (d jsondiff) String() string {
+	fmsg := "%v %q: gson %v, encoding/json %v"
+	return fmt.Sprintf(fmsg, d.Kind, d.Pointer, d.Gson, d.Stdlib)
+}
+
+// verifyDifferential parse input with gson and with encoding/json and
+// compare the values, then re-encode gson's value with Value.Tojson and
+// compare encoding/json's parse of it with the original.
+func verifyDifferential(params cfgparams, input string) error {
+	config := params.config()
+	gval, gerr := gsonParse(config, []byte(input))
+	sval, serr := stdlibParse([]byte(input))
+
+	diffs := []jsondiff{}
+	switch {
+	case gerr != nil && serr != nil:
+		return nil
+	case gerr != nil:
+		diffs = append(diffs, jsondiff{"", "accept", gerr.Error(), "ok"})
+	case serr != nil:
+		if !params.Strict { // lenient gson accept more than the spec.
+			return nil
+		}
+		diffs = append(diffs, jsondiff{"", "accept", "ok", serr.Error()})
+	default:
+		diffs = diffJSON(params, "", gval, sval, diffs)
+		out := config.NewJson(make([]byte, 0, 10*len(input)+1024))
+		config.NewValue(gval).Tojson(out)
+		rval, rerr := stdlibParse(out.Bytes())
+		if rerr != nil {
+			d := jsondiff{"", "reencode", string(out.Bytes()), rerr.Error()}
+			diffs = append(diffs, d)
+		} else {
+			rdiffs := diffJSON(params, "", rval, sval, []jsondiff{})
+			for _, d := range rdiffs {
+				d.Kind = "reencode"
+				diffs = append(diffs, d)
+			}
+		}
+	}
+	if len(diffs) == 0 {
+		verbosef("verifyDifferential ... ok\n")
+		return nil
+	}
+	lines := []string{}
+	for _, d := range diffs {
+		lines = append(lines, d.String())
+	}
+	return fmt.Errorf("differential:\n  %v", strings.Join(lines, "\n  "))
+}
+
+func gsonParse(config *gson.Config, data []byte) (val interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			val, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	rem, val := config.NewJson(data).Tovalue()
+	if rem != nil && len(bytes.TrimSpace(rem.Bytes())) > 0 {
+		return nil, fmt.Errorf("left over %q", rem.Bytes())
+	}
+	return val, nil
+}
+
+func stdlibParse(data []byte) (val interface{}, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	var extra interface{}
+	if err := dec.Decode(&extra); err != io.EOF {
+		return nil, fmt.Errorf("left over after value")
+	}
+	return val, nil
+}
+
+// diffJSON compare gson value g with encoding/json value s, numbers are
+// compared under the agreed mapping of params.NumberKind.
+func diffJSON(
+	params cfgparams, ptr string, g, s interface{},
+	diffs []jsondiff) []jsondiff {
+
+	if m, ok := g.(gson.Missing); ok {
+		g = string(m)
+	}
+	gtyp, styp := fmt.Sprintf("%T", g), fmt.Sprintf("%T", s)
+	switch sv := s.(type) {
+	case json.Number:
+		gnum, ok := gsonNumber(g)
+		if !ok {
+			return append(diffs, jsondiff{ptr, "type", gtyp, styp})
+		}
+		if snum := stdlibNumber(params, sv); gnum != snum {
+			return append(diffs, jsondiff{ptr, "value", gnum, snum})
+		}
+
+	case []interface{}:
+		gv, ok := g.([]interface{})
+		if !ok {
+			return append(diffs, jsondiff{ptr, "type", gtyp, styp})
+		} else if len(gv) != len(sv) {
+			gn, sn := fmt.Sprint("len ", len(gv)), fmt.Sprint("len ", len(sv))
+			return append(diffs, jsondiff{ptr, "value", gn, sn})
+		}
+		for i := range sv {
+			iptr := ptr + "/" + strconv.Itoa(i)
+			diffs = diffJSON(params, iptr, gv[i], sv[i], diffs)
+		}
+
+	case map[string]interface{}:
+		gv, ok := g.(map[string]interface{})
+		if !ok {
+			return append(diffs, jsondiff{ptr, "type", gtyp, styp})
+		}
+		keys := []string{}
+		for key := range sv {
+			keys = append(keys, key)
+		}
+		for key := range gv {
+			if _, ok := sv[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			kptr := ptr + "/" + escapePointer(key)
+			gitem, gok := gv[key]
+			sitem, sok := sv[key]
+			if !gok || !sok {
+				gs, ss := fmt.Sprint(gok), fmt.Sprint(sok)
+				diffs = append(diffs, jsondiff{kptr, "key", gs, ss})
+				continue
+			}
+			diffs = diffJSON(params, kptr, gitem, sitem, diffs)
+		}
+
+	default: // nil, bool and string
+		if gtyp != styp {
+			return append(diffs, jsondiff{ptr, "type", gtyp, styp})
+		} else if g != s {
+			gs, ss := fmt.Sprintf("%q", g), fmt.Sprintf("%q", s)
+			return append(diffs, jsondiff{ptr, "value", gs, ss})
+		}
+	}
+	return diffs
+}
+
+// gsonNumber format a number decoded by gson.
+func gsonNumber(g interface{}) (string, bool) {
+	switch v := g.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	}
+	return "", false
+}
+
+// stdlibNumber format a number decoded by encoding/json, integers that
+// fit 64 bits are exact for SmartNumber, everything else is a float64.
+func stdlibNumber(params cfgparams, n json.Number) string {
+	if params.NumberKind == "smart" && !strings.ContainsAny(string(n), ".eE") {
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		} else if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			return strconv.FormatUint(u, 10)
+		}
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return string(n)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// escapePointer escape key as a JSON pointer segment.
+func escapePointer(key string) string {
+	key = strings.Replace(key, "~", "~0", -1)
+	return strings.Replace(key, "/", "~1", -1)
+}
@@ -0,0 +1,47 @@
+package main
+
+import "encoding/json"
+import "testing"
+
+func TestDiffJSON(t *testing.T) {
+	smart := cfgparams{NumberKind: "smart"}
+	float := cfgparams{NumberKind: "float"}
+
+	g := map[string]interface{}{
+		"a": []interface{}{int64(10), 1.5, "x"}, "b/c": nil,
+	}
+	s := map[string]interface{}{
+		"a":   []interface{}{json.Number("10"), json.Number("15e-1"), "x"},
+		"b/c": nil,
+	}
+	if diffs := diffJSON(smart, "", g, s, nil); len(diffs) > 0 {
+		t.Errorf("unexpected %v", diffs)
+	}
+
+	g["a"].([]interface{})[2] = "y"
+	s["b/c"] = true
+	diffs := diffJSON(smart, "", g, s, nil)
+	refs := []jsondiff{
+		{"/a/2", "value", `"y"`, `"x"`}, {"/b~1c", "type", "<nil>", "bool"},
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %v", diffs)
+	}
+	for i, ref := range refs {
+		if diffs[i] != ref {
+			t.Errorf("expected %v, got %v", ref, diffs[i])
+		}
+	}
+
+	// integers beyond float64 precision are exact only for SmartNumber.
+	big, n := json.Number("1152921504606846977"), uint64(1152921504606846977)
+	if diffs := diffJSON(smart, "", n, big, nil); len(diffs) > 0 {
+		t.Errorf("unexpected %v", diffs)
+	}
+	if diffs := diffJSON(float, "", float64(n), big, nil); len(diffs) > 0 {
+		t.Errorf("unexpected %v", diffs)
+	}
+	if diffs := diffJSON(smart, "", float64(n), big, nil); len(diffs) != 1 {
+		t.Errorf("expected 1 diff, got %v", diffs)
+	}
+}
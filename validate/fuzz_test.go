@@ -0,0 +1,129 @@
+package main
+
+import "io/ioutil"
+import "regexp"
+import "strings"
+import "testing"
+
+import "github.com/bnclabs/gson"
+
+func FuzzJsonToValue(f *testing.F)    { fuzzEdge(f, reprJSON, reprValue) }
+func FuzzJsonToCbor(f *testing.F)     { fuzzEdge(f, reprJSON, reprCbor) }
+func FuzzJsonToCollate(f *testing.F)  { fuzzEdge(f, reprJSON, reprCollate) }
+func FuzzValueToJson(f *testing.F)    { fuzzEdge(f, reprValue, reprJSON) }
+func FuzzValueToCbor(f *testing.F)    { fuzzEdge(f, reprValue, reprCbor) }
+func FuzzValueToCollate(f *testing.F) { fuzzEdge(f, reprValue, reprCollate) }
+func FuzzCborToJson(f *testing.F)     { fuzzEdge(f, reprCbor, reprJSON) }
+func FuzzCborToValue(f *testing.F)    { fuzzEdge(f, reprCbor, reprValue) }
+func FuzzCborToCollate(f *testing.F)  { fuzzEdge(f, reprCbor, reprCollate) }
+func FuzzCollateToJson(f *testing.F)  { fuzzEdge(f, reprCollate, reprJSON) }
+func FuzzCollateToValue(f *testing.F) { fuzzEdge(f, reprCollate, reprValue) }
+func FuzzCollateToCbor(f *testing.F)  { fuzzEdge(f, reprCollate, reprCbor) }
+
+// fuzzEdge fuzz the conversion from -> to, with JSON text as input.
+// Input is first brought into `from` representation, then converted
+// and verified with the reference value, like the validate tool does
+// for every hop. Inputs that gson cannot parse are skipped.
+func fuzzEdge(f *testing.F, from, to repr) {
+	var target *edge
+	for _, e := range edges {
+		if e.from == from && e.to == to {
+			target = e
+		}
+	}
+	if target == nil {
+		f.Fatalf("no edge %v2%v", from, to)
+	}
+
+	for _, seed := range fuzzSeeds(f) {
+		for bits := 0; bits < 128; bits += 37 {
+			f.Add([]byte(seed), uint8(bits))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, bits uint8) {
+		config := fuzzParams(bits).config()
+		ref, ok := fuzzReference(config, data)
+		if !ok {
+			t.Skip()
+		}
+
+		in := &stage{kind: reprJSON, jsn: config.NewJson(data)}
+		if from != reprJSON {
+			var err error
+			for _, e := range edges {
+				if e.from == reprJSON && e.to == from {
+					in, err = hop(config, e, in, ref)
+				}
+			}
+			if err != nil { // failure belongs to json2<from>.
+				t.Skip()
+			}
+		}
+		if _, err := hop(config, target, in, ref); err != nil {
+			t.Fatalf("%v on %q under %v: %v", chain{target}, data, config, err)
+		}
+	})
+}
+
+// fuzzParams pick config choices from bits, so that config is also
+// subjected to coverage guidance.
+func fuzzParams(bits uint8) cfgparams {
+	params := cfgparams{
+		NumberKind: "smart", SpaceKind: "ansi", Container: "lenprefix",
+		ArrayLen: bits&0x08 != 0, PropertyLen: bits&0x10 != 0,
+		Missing: bits&0x20 != 0, Strict: bits&0x40 != 0,
+	}
+	if bits&0x01 != 0 {
+		params.NumberKind = "float"
+	}
+	if bits&0x02 != 0 {
+		params.SpaceKind = "unicode"
+	}
+	if bits&0x04 != 0 {
+		params.Container = "stream"
+	}
+	return params
+}
+
+func fuzzReference(
+	config *gson.Config, data []byte) (ref interface{}, ok bool) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			ref, ok = nil, false
+		}
+	}()
+	rem, _ := config.NewJson(data).Tovalue()
+	if rem != nil && strings.TrimSpace(string(rem.Bytes())) != "" {
+		return nil, false
+	}
+	return reference(config, data), true
+}
+
+var checkinput = regexp.MustCompile(`^runinput '[^']*' '(.*)'$`)
+
+// fuzzSeeds from testdata/scan_valid, testdata/typical.json and the
+// inputs validated by check.sh.
+func fuzzSeeds(f *testing.F) []string {
+	read := func(filename string) string {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			f.Fatal(err)
+		}
+		return string(data)
+	}
+
+	seeds := []string{read("../testdata/typical.json")}
+	for _, line := range strings.Split(read("../testdata/scan_valid"), "\n") {
+		if line != "" {
+			seeds = append(seeds, line)
+		}
+	}
+	for _, line := range strings.Split(read("check.sh"), "\n") {
+		if m := checkinput.FindStringSubmatch(line); m != nil {
+			seeds = append(seeds, m[1])
+		}
+	}
+	return seeds
+}
@@ -0,0 +1,229 @@
+package main
+
+import "fmt"
+import "strings"
+import "runtime/debug"
+
+import "github.com/bnclabs/gson"
+
+// repr is one of the four representations of a document in gson.
+type repr byte
+
+const (
+	reprJSON repr = iota + 1
+	reprValue
+	reprCbor
+	reprCollate
+)
+
+func (r repr) String() string {
+	switch r {
+	case reprJSON:
+		return "json"
+	case reprValue:
+		return "value"
+	case reprCbor:
+		return "cbor"
+	case reprCollate:
+		return "collate"
+	}
+	panic(fmt.Errorf("unknown representation %d", r))
+}
+
+// stage is a document held in one of the representations, as produced
+// by the last hop of a chain.
+type stage struct {
+	kind repr
+	jsn  *gson.Json
+	val  interface{}
+	cbr  *gson.Cbor
+	clt  *gson.Collate
+}
+
+// tovalue decodes the stage back into golang value, this is the value
+// verified against the reference.
+func (s *stage) tovalue() interface{} {
+	switch s.kind {
+	case reprJSON:
+		_, value := s.jsn.Tovalue()
+		return value
+	case reprValue:
+		return s.val
+	case reprCbor:
+		return s.cbr.Tovalue()
+	case reprCollate:
+		return s.clt.Tovalue()
+	}
+	panic(fmt.Errorf("unknown representation %v", s.kind))
+}
+
+// edge is a single To* conversion from one representation to another.
+type edge struct {
+	from, to repr
+	convert  func(config *gson.Config, in *stage) *stage
+}
+
+// edges of the transform graph, to add a new conversion add an edge
+// here, engine shall pick it up in every chain passing through `from`.
+var edges = []*edge{
+	{reprJSON, reprValue, func(config *gson.Config, in *stage) *stage {
+		_, value := in.jsn.Tovalue()
+		return &stage{kind: reprValue, val: value}
+	}},
+	{reprJSON, reprCbor, func(config *gson.Config, in *stage) *stage {
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		return &stage{kind: reprCbor, cbr: in.jsn.Tocbor(cbr)}
+	}},
+	{reprJSON, reprCollate, func(config *gson.Config, in *stage) *stage {
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return &stage{kind: reprCollate, clt: in.jsn.Tocollate(clt)}
+	}},
+	{reprValue, reprJSON, func(config *gson.Config, in *stage) *stage {
+		jsn := config.NewJson(make([]byte, 0, 1024))
+		return &stage{kind: reprJSON, jsn: config.NewValue(in.val).Tojson(jsn)}
+	}},
+	{reprValue, reprCbor, func(config *gson.Config, in *stage) *stage {
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		return &stage{kind: reprCbor, cbr: config.NewValue(in.val).Tocbor(cbr)}
+	}},
+	{reprValue, reprCollate, func(config *gson.Config, in *stage) *stage {
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return &stage{
+			kind: reprCollate, clt: config.NewValue(in.val).Tocollate(clt),
+		}
+	}},
+	{reprCbor, reprJSON, func(config *gson.Config, in *stage) *stage {
+		jsn := config.NewJson(make([]byte, 0, 1024))
+		return &stage{kind: reprJSON, jsn: in.cbr.Tojson(jsn)}
+	}},
+	{reprCbor, reprValue, func(config *gson.Config, in *stage) *stage {
+		return &stage{kind: reprValue, val: in.cbr.Tovalue()}
+	}},
+	{reprCbor, reprCollate, func(config *gson.Config, in *stage) *stage {
+		clt := config.NewCollate(make([]byte, 0, 1024))
+		return &stage{kind: reprCollate, clt: in.cbr.Tocollate(clt)}
+	}},
+	{reprCollate, reprJSON, func(config *gson.Config, in *stage) *stage {
+		jsn := config.NewJson(make([]byte, 0, 1024))
+		return &stage{kind: reprJSON, jsn: in.clt.Tojson(jsn)}
+	}},
+	{reprCollate, reprValue, func(config *gson.Config, in *stage) *stage {
+		return &stage{kind: reprValue, val: in.clt.Tovalue()}
+	}},
+	{reprCollate, reprCbor, func(config *gson.Config, in *stage) *stage {
+		cbr := config.NewCbor(make([]byte, 0, 1024))
+		return &stage{kind: reprCbor, cbr: in.clt.Tocbor(cbr)}
+	}},
+}
+
+// chain is a path of edges through the transform graph, starting
+// from the input JSON text.
+type chain []*edge
+
+// String name a chain by the representations it passes through,
+// like json2value2cbor2collate.
+func (c chain) String() string {
+	names := []string{reprJSON.String()}
+	for _, e := range c {
+		names = append(names, e.to.String())
+	}
+	return strings.Join(names, "2")
+}
+
+// walkTransforms walk every chain of length 1 to depth starting from
+// input JSON text, the last stage of each chain is decoded back to value
+// and verified with the reference value. callback is called for each
+// chain with the verification result, if callback returns false walk
+// shall stop. Chains sharing a prefix share the conversions for that
+// prefix.
+func walkTransforms(
+	config *gson.Config, data []byte, depth int,
+	callback func(c chain, err error) bool) {
+
+	ref := reference(config, data)
+
+	adjacency := make(map[repr][]*edge)
+	for _, e := range edges {
+		adjacency[e.from] = append(adjacency[e.from], e)
+	}
+
+	var walk func(c chain, in *stage) bool
+	walk = func(c chain, in *stage) bool {
+		if len(c) == depth {
+			return true
+		}
+		for _, e := range adjacency[in.kind] {
+			next := append(c[:len(c):len(c)], e)
+			out, err := hop(config, e, in, ref)
+			if !callback(next, err) {
+				return false
+			}
+			if err != nil { // chains extending a failed hop are moot.
+				continue
+			}
+			if !walk(next, out) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(chain{}, &stage{kind: reprJSON, jsn: config.NewJson(data)})
+}
+
+// hop apply edge on the input stage and verify its output with
+// reference value.
+func hop(
+	config *gson.Config, e *edge, in *stage,
+	ref interface{}) (out *stage, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			stack := getStackTrace(2, debug.Stack())
+			out, err = nil, &panicError{r: r, stack: stack}
+		}
+	}()
+
+	out = e.convert(config, in)
+	value := gson.Fixtojson(config, out.tovalue())
+	if err := verifyobj(config, ref, value); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// runChain apply edges of chain c in sequence starting from input JSON
+// text, verifying every stage with the reference value.
+func runChain(config *gson.Config, data []byte, c chain) error {
+	_, err := applyChain(config, data, c)
+	return err
+}
+
+// applyChain is like runChain, returning the last stage.
+func applyChain(config *gson.Config, data []byte, c chain) (*stage, error) {
+	ref := reference(config, data)
+	in := &stage{kind: reprJSON, jsn: config.NewJson(data)}
+	for _, e := range c {
+		out, err := hop(config, e, in, ref)
+		if err != nil {
+			return nil, err
+		}
+		in = out
+	}
+	return in, nil
+}
+
+func reference(config *gson.Config, data []byte) interface{} {
+	_, ref := config.NewJson(data).Tovalue()
+	return gson.Fixtojson(config, ref)
+}
+
+// panicError is a panic recovered while applying an edge, along with
+// the stack trace at the point of panic.
+type panicError struct {
+	r     interface{}
+	stack string
+}
+
+func (err *panicError) Error() string {
+	return fmt.Sprintf("%v", err.r)
+}
@@ -0,0 +1,163 @@
+package main
+
+import "log"
+
+// matrix of configs to validate every document with, nil unless
+// -matrix is supplied.
+var matrix []cfgparams
+
+// dimension is one of the choices makeConfig makes for a config.
+type dimension struct {
+	name string
+	n    int
+	set  func(params *cfgparams, i int)
+}
+
+var dimensions = []dimension{
+	{"numberkind", 2, func(params *cfgparams, i int) {
+		params.NumberKind = []string{"smart", "float"}[i]
+	}},
+	{"spacekind", 2, func(params *cfgparams, i int) {
+		params.SpaceKind = []string{"ansi", "unicode"}[i]
+	}},
+	{"container", 2, func(params *cfgparams, i int) {
+		params.Container = []string{"lenprefix", "stream"}[i]
+	}},
+	{"arraylenprefix", 2, func(params *cfgparams, i int) {
+		params.ArrayLen = i == 1
+	}},
+	{"propertylenprefix", 2, func(params *cfgparams, i int) {
+		params.PropertyLen = i == 1
+	}},
+	{"missing", 2, func(params *cfgparams, i int) {
+		params.Missing = i == 1
+	}},
+	{"strict", 2, func(params *cfgparams, i int) {
+		params.Strict = i == 1
+	}},
+}
+
+// configMatrix return the "full" cartesian product of dimensions, or a
+// "pairwise" subset of it that covers every pair of choices from any
+// two dimensions.
+func configMatrix(kind string) []cfgparams {
+	combinations := fullCombinations()
+	switch kind {
+	case "full":
+	case "pairwise":
+		combinations = pairwise(combinations)
+	default:
+		log.Fatalf("unknown matrix %q, expected full or pairwise", kind)
+	}
+
+	params := make([]cfgparams, 0, len(combinations))
+	for _, combination := range combinations {
+		var p cfgparams
+		for d, i := range combination {
+			dimensions[d].set(&p, i)
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+// fullCombinations of dimensions, each combination is a list of choice
+// index for every dimension.
+func fullCombinations() [][]int {
+	combinations := [][]int{{}}
+	for _, dim := range dimensions {
+		next := [][]int{}
+		for _, combination := range combinations {
+			for i := 0; i < dim.n; i++ {
+				c := append(append([]int{}, combination...), i)
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// pair of choices from two dimensions, d1 < d2, choices are indices.
+type pair struct{ d1, i1, d2, i2 int }
+
+// String is the pair as "name:choice+name:choice".
+func (p pair) String() string {
+	choice := func(d, i int) string {
+		var params cfgparams
+		dimensions[d].set(&params, i)
+		return params.choices()[d]
+	}
+	return choice(p.d1, p.i1) + "+" + choice(p.d2, p.i2)
+}
+
+// pairsof combination, every pair of choices it covers.
+func pairsof(c []int) []pair {
+	pairs := []pair{}
+	for d1 := 0; d1 < len(c); d1++ {
+		for d2 := d1 + 1; d2 < len(c); d2++ {
+			pairs = append(pairs, pair{d1, c[d1], d2, c[d2]})
+		}
+	}
+	return pairs
+}
+
+// allPairs that a pairwise matrix shall cover.
+func allPairs() []pair {
+	pairs := []pair{}
+	for d1 := range dimensions {
+		for d2 := d1 + 1; d2 < len(dimensions); d2++ {
+			for i1 := 0; i1 < dimensions[d1].n; i1++ {
+				for i2 := 0; i2 < dimensions[d2].n; i2++ {
+					pairs = append(pairs, pair{d1, i1, d2, i2})
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// combinationOf params, the choice index for every dimension.
+func combinationOf(params cfgparams) []int {
+	combination := make([]int, 0, len(dimensions))
+	for _, dim := range dimensions {
+		for i := 0; i < dim.n; i++ {
+			p := params
+			if dim.set(&p, i); p == params {
+				combination = append(combination, i)
+				break
+			}
+		}
+	}
+	return combination
+}
+
+// pairwise pick combinations greedily, each time the one covering most
+// of the pairs not yet covered, until all pairs are covered.
+func pairwise(combinations [][]int) [][]int {
+	uncovered := map[pair]bool{}
+	for _, p := range allPairs() {
+		uncovered[p] = true
+	}
+
+	picked := [][]int{}
+	for len(uncovered) > 0 {
+		best, bestn := combinations[0], -1
+		for _, c := range combinations {
+			n := 0
+			for _, p := range pairsof(c) {
+				if uncovered[p] {
+					n++
+				}
+			}
+			if n > bestn {
+				best, bestn = c, n
+			}
+		}
+		for _, p := range pairsof(best) {
+			delete(uncovered, p)
+		}
+		picked = append(picked, best)
+	}
+	return picked
+}
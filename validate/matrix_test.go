@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestConfigMatrixFull(t *testing.T) {
+	params, seen := configMatrix("full"), map[cfgparams]bool{}
+	for _, p := range params {
+		seen[p] = true
+	}
+	if n := len(seen); n != 128 || len(params) != 128 {
+		t.Errorf("expected 128 configs, got %v unique of %v", n, len(params))
+	}
+}
+
+func TestConfigMatrixPairwise(t *testing.T) {
+	combinations := pairwise(fullCombinations())
+	if n := len(combinations); n >= 128 {
+		t.Errorf("expected pairwise subset, got %v combinations", n)
+	}
+	for d1 := range dimensions {
+		for d2 := d1 + 1; d2 < len(dimensions); d2++ {
+			for i1 := 0; i1 < dimensions[d1].n; i1++ {
+				for i2 := 0; i2 < dimensions[d2].n; i2++ {
+					covered := false
+					for _, c := range combinations {
+						covered = covered || (c[d1] == i1 && c[d2] == i2)
+					}
+					if !covered {
+						t.Errorf("%v=%v %v=%v not covered",
+							dimensions[d1].name, i1, dimensions[d2].name, i2)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCombinationOf(t *testing.T) {
+	combinations := fullCombinations()
+	for k, params := range configMatrix("full") {
+		ref, c := combinations[k], combinationOf(params)
+		if len(c) != len(ref) {
+			t.Fatalf("%v: expected %v, got %v", params, ref, c)
+		}
+		for d := range ref {
+			if c[d] != ref[d] {
+				t.Fatalf("%v: expected %v, got %v", params, ref, c)
+			}
+		}
+	}
+	p := pair{0, 1, 2, 0}
+	if s, ref := p.String(), "numberkind:float+container:lenprefix"; s != ref {
+		t.Errorf("expected %v, got %v", ref, s)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import "encoding/hex"
+import "fmt"
+import "math/rand"
+import "path"
+import "runtime"
+import "runtime/debug"
+import "sort"
+import "strings"
+import "sync"
+import "sync/atomic"
+import "time"
+
+import "github.com/bnclabs/gson"
+
+// decoder feeds an input in one of the encodings to gson, decoders
+// returning a value shall also feed the value to Value's To* methods.
+type decoder struct {
+	name   string
+	from   repr
+	decode func(config *gson.Config, data []byte)
+}
+
+var decoders = []*decoder{
+	{"json.Tovalue", reprJSON, func(config *gson.Config, data []byte) {
+		_, value := config.NewJson(data).Tovalue()
+		value2all(config, value, len(data))
+	}},
+	{"json.Tocbor", reprJSON, func(config *gson.Config, data []byte) {
+		config.NewJson(data).Tocbor(config.NewCbor(mutbuffer(data)))
+	}},
+	{"json.Tocollate", reprJSON, func(config *gson.Config, data []byte) {
+		config.NewJson(data).Tocollate(config.NewCollate(mutbuffer(data)))
+	}},
+	{"cbor.Tovalue", reprCbor, func(config *gson.Config, data []byte) {
+		value2all(config, config.NewCbor(data).Tovalue(), len(data))
+	}},
+	{"cbor.Tojson", reprCbor, func(config *gson.Config, data []byte) {
+		config.NewCbor(data).Tojson(config.NewJson(mutbuffer(data)))
+	}},
+	{"cbor.Tocollate", reprCbor, func(config *gson.Config, data []byte) {
+		config.NewCbor(data).Tocollate(config.NewCollate(mutbuffer(data)))
+	}},
+	{"collate.Tovalue", reprCollate, func(config *gson.Config, data []byte) {
+		value2all(config, config.NewCollate(data).Tovalue(), len(data))
+	}},
+	{"collate.Tojson", reprCollate, func(config *gson.Config, data []byte) {
+		config.NewCollate(data).Tojson(config.NewJson(mutbuffer(data)))
+	}},
+	{"collate.Tocbor", reprCollate, func(config *gson.Config, data []byte) {
+		config.NewCollate(data).Tocbor(config.NewCbor(mutbuffer(data)))
+	}},
+}
+
+func value2all(config *gson.Config, value interface{}, n int) {
+	val := config.NewValue(value)
+	val.Tojson(config.NewJson(make([]byte, 0, 10*n+1024)))
+	val.Tocbor(config.NewCbor(make([]byte, 0, 10*n+1024)))
+	val.Tocollate(config.NewCollate(make([]byte, 0, 10*n+1024)))
+}
+
+func mutbuffer(data []byte) []byte {
+	return make([]byte, 0, 10*len(data)+1024)
+}
+
+// mutators, each return a new mutated copy of data, other is an input
+// in the same encoding to splice with.
+var mutators = map[string]func(mrand *rand.Rand, data, other []byte) []byte{
+	"flip": func(mrand *rand.Rand, data, other []byte) []byte {
+		out := append([]byte{}, data...)
+		for n := 1 + mrand.Intn(4); n > 0 && len(out) > 0; n-- {
+			out[mrand.Intn(len(out))] ^= 1 << uint(mrand.Intn(8))
+		}
+		return out
+	},
+	"truncate": func(mrand *rand.Rand, data, other []byte) []byte {
+		if len(data) == 0 {
+			return []byte{}
+		}
+		return append([]byte{}, data[:mrand.Intn(len(data))]...)
+	},
+	"splice": func(mrand *rand.Rand, data, other []byte) []byte {
+		i, j := mrand.Intn(len(data)+1), mrand.Intn(len(other)+1)
+		out := append([]byte{}, data[:i]...)
+		return append(out, other[j:]...)
+	},
+}
+
+// crashgroup is a set of crashes sharing the same stack signature.
+type crashgroup struct {
+	signature string
+	decoder   string
+	err       string
+	input     []byte
+	count     int
+}
+
+var mutstats = struct {
+	sync.Mutex
+	mutations int
+	errors    int
+	accepted  map[string]int
+	samples   map[string][]byte
+	hangs     map[string][]byte
+	crashes   map[string]*crashgroup
+}{
+	accepted: make(map[string]int),
+	samples:  make(map[string][]byte),
+	hangs:    make(map[string][]byte),
+	crashes:  make(map[string]*crashgroup),
+}
+
+// abandoned is the number of decoders that timed out and are still
+// running, there is no way to stop them.
+var abandoned int32
+
+// validateMutations encode every generated document as json, cbor and
+// collate, mutate each encoding count times and feed the mutated input
+// to every decoder for that encoding.
+func validateMutations(count int) {
+	_, filename, _, _ := runtime.Caller(0)
+	prodfile := path.Join(path.Dir(filename), "2i.json.prod")
+	ch := generateJSON(prodfile, options.seed, options.count)
+
+	mrand := rand.New(rand.NewSource(int64(options.seed)))
+	names := []string{}
+	for name := range mutators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	last := map[repr][]byte{}
+docs:
+	for jsonstr := range ch {
+		config, params := makeConfig(mrand)
+		data := []byte(jsonstr)
+		inputs := map[repr][]byte{
+			reprJSON: data,
+			reprCbor: config.NewJson(data).Tocbor(
+				config.NewCbor(mutbuffer(data))).Bytes(),
+			reprCollate: config.NewJson(data).Tocollate(
+				config.NewCollate(mutbuffer(data))).Bytes(),
+		}
+		for _, kind := range []repr{reprJSON, reprCbor, reprCollate} {
+			input := inputs[kind]
+			other, ok := last[kind]
+			if !ok {
+				other = input
+			}
+			for i := 0; i < count; i++ {
+				name := names[mrand.Intn(len(names))]
+				mutated := mutators[name](mrand, input, other)
+				for _, dec := range decoders {
+					if tooManyHangs() {
+						break docs
+					}
+					if dec.from == kind {
+						mutateDecode(config, params, dec, mutated)
+					}
+				}
+			}
+			last[kind] = input
+		}
+	}
+	printMutations()
+}
+
+// tooManyHangs is true once options.maxhangs decoders are abandoned.
+func tooManyHangs() bool {
+	n := atomic.LoadInt32(&abandoned)
+	if int(n) < options.maxhangs {
+		return false
+	}
+	write("stop mutating, %v hung decoders still running\n", n)
+	return true
+}
+
+// mutateDecode feed input to decoder and record the outcome.
+func mutateDecode(
+	config *gson.Config, params cfgparams, dec *decoder, input []byte) {
+
+	outcome, stack := decodeOutcome(config, dec, input, options.timeout)
+
+	mutstats.Lock()
+	defer mutstats.Unlock()
+
+	mutstats.mutations++
+	switch {
+	case outcome == "error":
+		mutstats.errors++
+	case outcome == "accepted":
+		if _, ok := mutstats.samples[dec.name]; !ok {
+			mutstats.samples[dec.name] = input
+		}
+		mutstats.accepted[dec.name]++
+	case outcome == "hang":
+		if _, ok := mutstats.hangs[dec.name]; !ok {
+			mutstats.hangs[dec.name] = input
+			saveFailure(params, "decode:"+dec.name, hex.EncodeToString(input),
+				"", fmt.Errorf("hang"))
+		}
+		incrparam("fail", 1)
+	default: // crash
+		signature := stackSignature(stack)
+		group, ok := mutstats.crashes[signature]
+		if !ok {
+			group = &crashgroup{
+				signature: signature, decoder: dec.name, err: outcome,
+				input: input,
+			}
+			mutstats.crashes[signature] = group
+			saveFailure(params, "decode:"+dec.name, hex.EncodeToString(input),
+				"", fmt.Errorf("%v", outcome))
+		}
+		group.count++
+		incrparam("fail", 1)
+	}
+}
+
+// decodeOutcome classify decoding input as, "accepted", "error" for
+// errors raised by gson, "hang" if decoder did not return within
+// timeout, and the runtime error for crashes along with its stack. A
+// hung decoder is left running and counted as abandoned until it
+// returns.
+func decodeOutcome(
+	config *gson.Config, dec *decoder, input []byte,
+	timeout time.Duration) (outcome, stack string) {
+
+	type result struct{ outcome, stack string }
+	donech := make(chan result, 1)
+	var state int32 // 0 running, 1 abandoned, 2 returned.
+	go func() {
+		defer func() {
+			if !atomic.CompareAndSwapInt32(&state, 0, 2) {
+				atomic.AddInt32(&abandoned, -1)
+			}
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				if err, ok := r.(runtime.Error); ok {
+					donech <- result{err.Error(), string(debug.Stack())}
+					return
+				}
+				donech <- result{"error", ""}
+			}
+		}()
+		dec.decode(config, input)
+		donech <- result{"accepted", ""}
+	}()
+	select {
+	case res := <-donech:
+		return res.outcome, res.stack
+	case <-time.After(timeout):
+		if atomic.CompareAndSwapInt32(&state, 0, 1) {
+			atomic.AddInt32(&abandoned, 1)
+			return "hang", ""
+		}
+		res := <-donech // returned just as it timed out.
+		return res.outcome, res.stack
+	}
+}
+
+// stackSignature is the top most gson frames in a panic stack, crashes
+// with the same signature are likely the same bug.
+func stackSignature(stack string) string {
+	frames := []string{}
+	for _, line := range strings.Split(stack, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			continue
+		} else if !strings.Contains(line, "bnclabs/gson.") {
+			continue
+		}
+		if i := strings.LastIndex(line, "("); i > 0 {
+			line = line[:i]
+		}
+		frames = append(frames, path.Base(line))
+		if len(frames) == 3 {
+			break
+		}
+	}
+	if len(frames) == 0 {
+		return "<no gson frames>"
+	}
+	return strings.Join(frames, " <- ")
+}
+
+func printMutations() {
+	mutstats.Lock()
+	defer mutstats.Unlock()
+
+	fmsg := "mutations: %v, errors: %v, hangs: %v, crash groups: %v, " +
+		"still running: %v\n"
+	write(fmsg, mutstats.mutations, mutstats.errors, len(mutstats.hangs),
+		len(mutstats.crashes), atomic.LoadInt32(&abandoned))
+
+	for _, dec := range decoders {
+		if n := mutstats.accepted[dec.name]; n > 0 {
+			sample := hex.EncodeToString(mutstats.samples[dec.name])
+			write("accepted %-16v: %v, sample %v\n", dec.name, n, sample)
+		}
+	}
+	for _, dec := range decoders {
+		if input, ok := mutstats.hangs[dec.name]; ok {
+			write("hang     %-16v: %v\n", dec.name, hex.EncodeToString(input))
+		}
+	}
+	groups := []*crashgroup{}
+	for _, group := range mutstats.crashes {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].count > groups[j].count
+	})
+	for i, group := range groups {
+		write("crash #%v (%v times) %v: %v\n",
+			i+1, group.count, group.decoder, group.err)
+		write("  signature: %v\n", group.signature)
+		write("  input    : %v\n", hex.EncodeToString(group.input))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import "errors"
+import "fmt"
+import "hash/fnv"
+import "math/rand"
+import "sort"
+import "strconv"
+
+import "github.com/bnclabs/gson"
+
+// refAppend return a copy of doc with item appended to the array
+// pointed by segments, whose last token shall be "-".
+func refAppend(
+	doc interface{}, segments []string, item interface{}) (interface{}, error) {
+
+	if len(segments) == 0 || segments[len(segments)-1] != "-" {
+		return nil, errors.New("append pointer shall end with -")
+	}
+	doc = deepcopy(doc)
+	parent, err := refGet(doc, segments[:len(segments)-1])
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := parent.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot append to %T", parent)
+	}
+	arr = append(arr, deepcopy(item))
+	if len(segments) == 1 {
+		return arr, nil
+	}
+	return refSet(doc, segments[:len(segments)-1], arr)
+}
+
+// refDelete return a copy of doc with the item pointed by segments
+// removed, later elements of an array shift down.
+func refDelete(doc interface{}, segments []string) (interface{}, error) {
+	if len(segments) == 0 {
+		return nil, errors.New("cannot delete root")
+	}
+	doc = deepcopy(doc)
+	parentsegs, token := segments[:len(segments)-1], segments[len(segments)-1]
+	parent, err := refGet(doc, parentsegs)
+	if err != nil {
+		return nil, err
+	}
+	switch v := parent.(type) {
+	case []interface{}:
+		i, err := refIndex(token, len(v))
+		if err != nil {
+			return nil, err
+		}
+		arr := append(v[:i:i], v[i+1:]...)
+		if len(parentsegs) == 0 {
+			return arr, nil
+		}
+		return refSet(doc, parentsegs, arr)
+	case map[string]interface{}:
+		if _, ok := v[token]; !ok {
+			return nil, fmt.Errorf("no property %q", token)
+		}
+		delete(v, token)
+		return doc, nil
+	}
+	return nil, fmt.Errorf("cannot delete %q in %T", token, parent)
+}
+
+// itemPointers are pointers to every item in doc, except the root.
+func itemPointers(doc interface{}) []string {
+	pointers := []string{}
+	var walk func(prefix string, doc interface{})
+	walk = func(prefix string, doc interface{}) {
+		if prefix != "" {
+			pointers = append(pointers, prefix)
+		}
+		switch v := doc.(type) {
+		case []interface{}:
+			for i, item := range v {
+				walk(prefix+"/"+strconv.Itoa(i), item)
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				walk(prefix+"/"+escapePointer(key), item)
+			}
+		}
+	}
+	walk("", doc)
+	sort.Strings(pointers)
+	return pointers
+}
+
+// emptyof return an empty container of the same type as doc, or doc
+// itself if it is not a container.
+func emptyof(doc interface{}) interface{} {
+	switch doc.(type) {
+	case []interface{}:
+		return []interface{}{}
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	}
+	return doc
+}
+
+// opdoc is the same document held as plain golang model, as gson.Value
+// and as gson.Cbor, every op is applied to all three.
+type opdoc struct {
+	config *gson.Config
+	model  interface{}
+	val    interface{}
+	cbr    *gson.Cbor
+	steps  int
+}
+
+func newOpdoc(config *gson.Config, root interface{}) *opdoc {
+	return &opdoc{
+		config: config, model: deepcopy(root), val: deepcopy(root),
+		cbr: cborof(config, root),
+	}
+}
+
+// apply op, one of "get", "set", "append" and "delete", at pointer on
+// every representation and check that gson agrees with the model.
+func (d *opdoc) apply(op, pointer string, item interface{}) (err error) {
+	d.steps++
+	segments, err := refSegments(pointer)
+	if err != nil {
+		return err
+	}
+	var model interface{}
+	switch op {
+	case "get":
+		return d.get(pointer, segments)
+	case "set":
+		model, err = refSet(d.model, segments, item)
+	case "append":
+		model, err = refAppend(d.model, segments, item)
+	case "delete":
+		model, err = refDelete(d.model, segments)
+	}
+	if err != nil {
+		return fmt.Errorf("step %v %v %q: model: %v", d.steps, op, pointer, err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmsg := "step %v %v %q: panic: %v"
+			err = fmt.Errorf(fmsg, d.steps, op, pointer, r)
+		}
+	}()
+
+	config, jptr := d.config, d.config.NewJsonpointer(pointer)
+	n := 2*len(d.cbr.Bytes()) + 1024
+	newcbr := config.NewCbor(make([]byte, 0, n))
+	oldcbr := config.NewCbor(make([]byte, 0, n))
+	switch op {
+	case "set", "append":
+		val := config.NewValue(deepcopy(d.val))
+		d.val, _ = val.Set(jptr, deepcopy(item))
+		d.cbr = d.cbr.Set(jptr, cborof(config, item), newcbr, oldcbr)
+	case "delete":
+		val := config.NewValue(deepcopy(d.val))
+		d.val, _ = val.Delete(jptr)
+		d.cbr = d.cbr.Delete(jptr, newcbr, oldcbr)
+	}
+	d.model = model
+
+	ref := gson.Fixtojson(config, d.model)
+	value := gson.Fixtojson(config, d.val)
+	if err := verifyobj(config, ref, value); err != nil {
+		return fmt.Errorf("step %v %v %q: Value: %v", d.steps, op, pointer, err)
+	}
+	value = gson.CborMap2golangMap(d.cbr.Tovalue())
+	value = gson.Fixtojson(config, value)
+	if err := verifyobj(config, ref, value); err != nil {
+		return fmt.Errorf("step %v %v %q: Cbor: %v", d.steps, op, pointer, err)
+	}
+	return nil
+}
+
+// get item at pointer from Value and Cbor and check that it agrees
+// with the model.
+func (d *opdoc) get(pointer string, segments []string) (err error) {
+	ref, err := refGet(d.model, segments)
+	if err != nil {
+		return fmt.Errorf("step %v get %q: model: %v", d.steps, pointer, err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("step %v get %q: panic: %v", d.steps, pointer, r)
+		}
+	}()
+
+	config, jptr := d.config, d.config.NewJsonpointer(pointer)
+	ref = gson.Fixtojson(config, ref)
+	value := config.NewValue(deepcopy(d.val)).Get(jptr)
+	value = gson.Fixtojson(config, value)
+	if err := verifyobj(config, ref, value); err != nil {
+		return fmt.Errorf("step %v get %q: Value: %v", d.steps, pointer, err)
+	}
+	item := config.NewCbor(make([]byte, 0, len(d.cbr.Bytes())+1024))
+	value = gson.CborMap2golangMap(d.cbr.Get(jptr, item).Tovalue())
+	value = gson.Fixtojson(config, value)
+	if err := verifyobj(config, ref, value); err != nil {
+		return fmt.Errorf("step %v get %q: Cbor: %v", d.steps, pointer, err)
+	}
+	return nil
+}
+
+// verifyAppendDelete build doc from an empty root, appending array
+// elements through "-" pointers and setting properties, then tear it
+// down by deleting items in random order, on both Value and Cbor.
+// Every step is checked against a plain golang model of the document.
+func verifyAppendDelete(params cfgparams, input string) error {
+	// TODO: cbor pointer operations are only supported with Stream.
+	params.Container = "stream"
+	config := params.config()
+	_, doc := config.NewJson([]byte(input)).Tovalue()
+	doc = gson.Fixtojson(config, doc)
+
+	d := newOpdoc(config, emptyof(doc))
+	var build func(prefix string, doc interface{}) error
+	build = func(prefix string, doc interface{}) error {
+		switch v := doc.(type) {
+		case []interface{}:
+			for i, item := range v {
+				err := d.apply("append", prefix+"/-", emptyof(item))
+				if err != nil {
+					return err
+				}
+				err = build(prefix+"/"+strconv.Itoa(i), item)
+				if err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			keys := []string{}
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				ptr := prefix + "/" + escapePointer(key)
+				if err := d.apply("set", ptr, emptyof(v[key])); err != nil {
+					return err
+				}
+				if err := build(ptr, v[key]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := build("", doc); err != nil {
+		return fmt.Errorf("build: %v", err)
+	}
+	model := gson.Fixtojson(config, d.model)
+	if err := verifyobj(config, doc, model); err != nil {
+		return fmt.Errorf("build: model: %v", err)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(input))
+	mrand := rand.New(rand.NewSource(int64(h.Sum64())))
+	for pointers := itemPointers(d.model); len(pointers) > 0; {
+		pointer := pointers[mrand.Intn(len(pointers))]
+		if err := d.apply("delete", pointer, nil); err != nil {
+			return fmt.Errorf("teardown: %v", err)
+		}
+		pointers = itemPointers(d.model)
+	}
+	verbosef("verifyAppendDelete ... ok\n")
+	return nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import "errors"
+import "fmt"
+import "regexp"
+import "sort"
+import "strconv"
+import "strings"
+
+import "github.com/bnclabs/gson"
+
+// rfc6901doc is the example document from RFC 6901, section 5.
+const rfc6901doc = `{
+  "foo": ["bar", "baz"], "": 0, "a/b": 1, "c%d": 2, "e^f": 3, "g|h": 4,
+  "i\\j": 5, "k\"l": 6, " ": 7, "m~n": 8
+}`
+
+// trickydoc has keys that need escaping, look like array indices or
+// are empty, along with nested arrays.
+const trickydoc = `{
+  "": {"": [0, [1, 2]]}, "~": 1, "/": 2, "~1": 3, "~0/": 4, "0": [5, 6],
+  "01": {"1": 7}, "-": [], "a/b~c": {"~/": [8, {"": 9}]}, "10": null
+}`
+
+// rfc6901pointers are the example pointers from RFC 6901, section 5.
+var rfc6901pointers = []string{
+	"", "/foo", "/foo/0", "/", "/a~1b", "/c%d", "/e^f", "/g|h", `/i\j`,
+	`/k"l`, "/ ", "/m~0n",
+}
+
+// setitem is set at every pointer that Set is checked with.
+var setitem = []interface{}{"~0/~1", nil}
+
+var invalidEscape = regexp.MustCompile(`~([^01]|$)`)
+
+// refSegments parse pointer into unescaped reference tokens.
+func refSegments(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	} else if pointer[0] != '/' {
+		return nil, fmt.Errorf("pointer %q does not start with /", pointer)
+	}
+	segments := strings.Split(pointer[1:], "/")
+	for i, segment := range segments {
+		if invalidEscape.MatchString(segment) {
+			return nil, fmt.Errorf("invalid escape in %q", pointer)
+		}
+		segment = strings.Replace(segment, "~1", "/", -1)
+		segments[i] = strings.Replace(segment, "~0", "~", -1)
+	}
+	return segments, nil
+}
+
+// refIndex parse token as index into an array of length n.
+func refIndex(token string, n int) (int, error) {
+	if token == "-" {
+		return 0, errors.New("- refers to a nonexistent element")
+	} else if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	for _, ch := range token {
+		if ch < '0' || ch > '9' {
+			return 0, fmt.Errorf("invalid array index %q", token)
+		}
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i >= n {
+		return 0, fmt.Errorf("array index %q out of range %v", token, n)
+	}
+	return i, nil
+}
+
+// refGet resolve segments in doc.
+func refGet(doc interface{}, segments []string) (interface{}, error) {
+	for _, token := range segments {
+		switch v := doc.(type) {
+		case []interface{}:
+			i, err := refIndex(token, len(v))
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+		case map[string]interface{}:
+			item, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("no property %q", token)
+			}
+			doc = item
+		default:
+			return nil, fmt.Errorf("cannot resolve %q in %T", token, v)
+		}
+	}
+	return doc, nil
+}
+
+// refSet return a copy of doc with item set at segments, the last
+// token can add a new property but not a new array element.
+func refSet(
+	doc interface{}, segments []string, item interface{}) (interface{}, error) {
+
+	if len(segments) == 0 {
+		return deepcopy(item), nil
+	}
+	doc = deepcopy(doc)
+	parent, err := refGet(doc, segments[:len(segments)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := segments[len(segments)-1]
+	switch v := parent.(type) {
+	case []interface{}:
+		i, err := refIndex(token, len(v))
+		if err != nil {
+			return nil, err
+		}
+		v[i] = deepcopy(item)
+	case map[string]interface{}:
+		v[token] = deepcopy(item)
+	default:
+		return nil, fmt.Errorf("cannot set %q in %T", token, v)
+	}
+	return doc, nil
+}
+
+func deepcopy(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			arr = append(arr, deepcopy(item))
+		}
+		return arr
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = deepcopy(item)
+		}
+		return m
+	}
+	return doc
+}
+
+// conformancePointers are pointers to every item in doc, along with
+// pointers that shall not resolve, out of range indices, indices with
+// leading zeros, "-", missing properties and tokens on scalars.
+func conformancePointers(doc interface{}) []string {
+	pointers := []string{}
+	var walk func(prefix string, doc interface{})
+	walk = func(prefix string, doc interface{}) {
+		pointers = append(pointers, prefix)
+		switch v := doc.(type) {
+		case []interface{}:
+			for i, item := range v {
+				walk(prefix+"/"+strconv.Itoa(i), item)
+			}
+			pointers = append(pointers, prefix+"/"+strconv.Itoa(len(v)))
+			pointers = append(pointers, prefix+"/-", prefix+"/-1")
+			if len(v) > 1 {
+				pointers = append(pointers, prefix+"/01")
+			}
+		case map[string]interface{}:
+			keys := []string{}
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(prefix+"/"+escapePointer(key), v[key])
+			}
+			missing := prefix + "/" + escapePointer("no~such/key")
+			pointers = append(pointers, missing)
+		default:
+			pointers = append(pointers, prefix+"/0")
+		}
+	}
+	walk("", doc)
+	return pointers
+}
+
+// verifyPointerConformance resolve every conformance pointer in doc,
+// with Jsonpointer, Value.Get/Set and Cbor.Get/Set, and check that they
+// agree with the reference resolver.
+func verifyPointerConformance(params cfgparams, doc interface{}) error {
+	// TODO: cbor pointer operations are only supported with Stream.
+	params.Container = "stream"
+	config := params.config()
+	doc = gson.Fixtojson(config, doc)
+
+	disagreements := []string{}
+	for _, pointer := range conformancePointers(doc) {
+		for _, d := range checkPointer(config, doc, pointer) {
+			d = fmt.Sprintf("%q %v", pointer, d)
+			disagreements = append(disagreements, d)
+		}
+	}
+	if len(disagreements) == 0 {
+		verbosef("verifyPointerConformance ... ok\n")
+		return nil
+	}
+	sort.Strings(disagreements)
+	fmsg := "pointer conformance:\n  %v"
+	return fmt.Errorf(fmsg, strings.Join(disagreements, "\n  "))
+}
+
+// checkPointer return disagreements with the reference for pointer.
+func checkPointer(
+	config *gson.Config, doc interface{}, pointer string) []string {
+
+	disagreements := []string{}
+	segments, err := refSegments(pointer)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	agree := func(
+		op string, ref interface{}, referr error, fn func() interface{}) {
+
+		value, err := pointerCall(fn)
+		switch {
+		case err != nil && referr != nil:
+		case err != nil:
+			msg := fmt.Sprintf("%v: gson %v, reference %v", op, err, ref)
+			disagreements = append(disagreements, msg)
+		case referr != nil:
+			msg := fmt.Sprintf("%v: gson %v, reference %v", op, value, referr)
+			disagreements = append(disagreements, msg)
+		default:
+			value = gson.Fixtojson(config, gson.CborMap2golangMap(value))
+			if err := verifyobj(config, ref, value); err != nil {
+				disagreements = append(disagreements, op+": "+err.Error())
+			}
+		}
+	}
+
+	jptr := config.NewJsonpointer(pointer)
+	gsegments := []string{}
+	for _, segment := range jptr.Segments() {
+		gsegments = append(gsegments, string(segment))
+	}
+	if fmt.Sprint(gsegments) != fmt.Sprint(segments) {
+		fmsg := "Segments: gson %q, reference %q"
+		msg := fmt.Sprintf(fmsg, gsegments, segments)
+		disagreements = append(disagreements, msg)
+	}
+
+	ref, referr := refGet(doc, segments)
+	agree("Value.Get", ref, referr, func() interface{} {
+		return config.NewValue(deepcopy(doc)).Get(jptr)
+	})
+	agree("Cbor.Get", ref, referr, func() interface{} {
+		item := config.NewCbor(make([]byte, 0, 1024))
+		return cborof(config, doc).Get(jptr, item).Tovalue()
+	})
+
+	if strings.HasSuffix(pointer, "/-") { // append is not a Set.
+		return disagreements
+	}
+	ref, referr = refSet(doc, segments, setitem)
+	agree("Value.Set", ref, referr, func() interface{} {
+		newdoc, _ := config.NewValue(deepcopy(doc)).Set(jptr, deepcopy(setitem))
+		return newdoc
+	})
+	agree("Cbor.Set", ref, referr, func() interface{} {
+		cbr, item := cborof(config, doc), cborof(config, setitem)
+		newdoc := config.NewCbor(make([]byte, 0, 2*len(cbr.Bytes())+1024))
+		old := config.NewCbor(make([]byte, 0, len(cbr.Bytes())+1024))
+		return cbr.Set(jptr, item, newdoc, old).Tovalue()
+	})
+	return disagreements
+}
+
+func cborof(config *gson.Config, value interface{}) *gson.Cbor {
+	return config.NewValue(value).Tocbor(config.NewCbor(make([]byte, 0, 1024)))
+}
+
+// pointerCall call fn, turning a panic into an error.
+func pointerCall(fn func() interface{}) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(), nil
+}
+
+// validatePointers run pointer conformance on the RFC 6901 example
+// document and its pointers, and on a document with tricky keys, under
+// the pairwise config matrix.
+func validatePointers() {
+	for _, params := range configMatrix("pairwise") {
+		config := params.config()
+		for _, text := range []string{rfc6901doc, trickydoc} {
+			_, doc := config.NewJson([]byte(text)).Tovalue()
+			err := verifyPointerConformance(params, doc)
+			if err == nil && text == rfc6901doc {
+				err = rfc6901examples(params, doc)
+			}
+			result := "pass"
+			if err != nil {
+				result = "fail"
+				incrparam("fail", 1)
+			} else {
+				incrparam("pass", 1)
+			}
+			doctext := strings.Join(strings.Fields(text), " ")
+			write("%-4v %v %v\n", result, params, doctext)
+			if err != nil {
+				write("  %v\n", err)
+			}
+		}
+	}
+}
+
+// rfc6901examples check the example pointers, most of them are also
+// generated by conformancePointers, with the values given in RFC 6901.
+func rfc6901examples(params cfgparams, doc interface{}) error {
+	params.Container = "stream"
+	config := params.config()
+	doc = gson.Fixtojson(config, doc)
+	refs := []interface{}{
+		doc, []interface{}{"bar", "baz"}, "bar",
+		0.0, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0,
+	}
+	for i, pointer := range rfc6901pointers {
+		segments, _ := refSegments(pointer)
+		value, err := refGet(doc, segments)
+		ref := gson.Fixtojson(config, refs[i])
+		if err == nil {
+			err = verifyobj(config, ref, value)
+		}
+		if err != nil {
+			return fmt.Errorf("%q: %v", pointer, err)
+		}
+		if ds := checkPointer(config, doc, pointer); len(ds) > 0 {
+			return fmt.Errorf("%q: %v", pointer, strings.Join(ds, ", "))
+		}
+	}
+	return nil
+}
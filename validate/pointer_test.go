@@ -0,0 +1,93 @@
+package main
+
+import "encoding/json"
+import "reflect"
+import "testing"
+
+func TestRefPointer(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(rfc6901doc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	refs := []interface{}{
+		doc, []interface{}{"bar", "baz"}, "bar",
+		0.0, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0,
+	}
+	for i, pointer := range rfc6901pointers {
+		segments, err := refSegments(pointer)
+		if err != nil {
+			t.Fatalf("%q: %v", pointer, err)
+		}
+		value, err := refGet(doc, segments)
+		if err != nil {
+			t.Errorf("%q: %v", pointer, err)
+		} else if !reflect.DeepEqual(value, refs[i]) {
+			t.Errorf("%q: expected %v, got %v", pointer, refs[i], value)
+		}
+	}
+
+	for _, pointer := range []string{"foo", "/~2", "/a~"} {
+		if _, err := refSegments(pointer); err == nil {
+			t.Errorf("%q: expected error", pointer)
+		}
+	}
+	invalids := []string{"/foo/2", "/foo/-", "/foo/01", "/x", "/ /0"}
+	for _, pointer := range invalids {
+		segments, _ := refSegments(pointer)
+		if _, err := refGet(doc, segments); err == nil {
+			t.Errorf("%q: expected error", pointer)
+		}
+	}
+}
+
+func TestRefSet(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a": [1, {"b": 2}]}`), &doc)
+	segments, _ := refSegments("/a/1/c~1d")
+	newdoc, err := refSet(doc, segments, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ref interface{}
+	json.Unmarshal([]byte(`{"a": [1, {"b": 2, "c/d": "x"}]}`), &ref)
+	if !reflect.DeepEqual(newdoc, ref) {
+		t.Errorf("expected %v, got %v", ref, newdoc)
+	} else if _, err := refGet(doc, segments); err == nil {
+		t.Errorf("refSet modified its input")
+	}
+	segments, _ = refSegments("/a/2")
+	if _, err := refSet(doc, segments, "x"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestRefAppendDelete(t *testing.T) {
+	var doc, ref interface{}
+	json.Unmarshal([]byte(`{"a": [1, 2, 3], "b": {"c": []}}`), &doc)
+
+	segments, _ := refSegments("/b/c/-")
+	doc, err := refAppend(doc, segments, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, _ = refSegments("/a/1")
+	if doc, err = refDelete(doc, segments); err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(`{"a": [1, 3], "b": {"c": ["x"]}}`), &ref)
+	if !reflect.DeepEqual(doc, ref) {
+		t.Errorf("expected %v, got %v", ref, doc)
+	}
+
+	segments, _ = refSegments("/a/-")
+	if _, err := refDelete(doc, segments); err == nil {
+		t.Errorf("expected error deleting -")
+	}
+	segments, _ = refSegments("/b/-")
+	if _, err := refAppend(doc, segments, 1); err == nil {
+		t.Errorf("expected error appending to object")
+	}
+	if _, err := refDelete(doc, []string{}); err == nil {
+		t.Errorf("expected error deleting root")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import "encoding/json"
+import "encoding/xml"
+import "io/ioutil"
+import "log"
+import "sort"
+import "time"
+
+// report is the machine readable summary of a run.
+type report struct {
+	Tool     string                `json:"tool"`
+	Seed     int                   `json:"seed"`
+	Elapsed  float64               `json:"elapsed"` // in seconds
+	Docs     int                   `json:"docs"`
+	Pass     int                   `json:"pass"`
+	Fail     int                   `json:"fail"`
+	Bytes    int                   `json:"bytes"`
+	Configs  map[string]int        `json:"configs"`
+	Types    map[string]int        `json:"types"`
+	Checks   map[string]*checkstat `json:"checks"`
+	Crosstab map[string]*crosscell `json:"crosstab"`
+	Pairs    map[string]*crosscell `json:"pairs"`
+	Failures []failcase            `json:"failures"`
+}
+
+var reportConfigs = []string{
+	"SmartNumber", "FloatNumber", "AnsiSpace", "UnicodeSpace",
+	"LengthPrefix", "Stream", "arrayLenPrefix", "propertyLenPrefix",
+	"doMissing", "strict", "strictRejects",
+}
+
+var reportTypes = []string{
+	"null", "true", "false", "num", "string", "array", "object",
+}
+
+func makeReport(elapsed time.Duration) *report {
+	statrw.RLock()
+	defer statrw.RUnlock()
+
+	r := &report{
+		Tool:     "validate",
+		Seed:     options.seed,
+		Elapsed:  elapsed.Seconds(),
+		Docs:     statistics["docs"].(int),
+		Pass:     statistics["pass"].(int),
+		Fail:     statistics["fail"].(int),
+		Bytes:    statistics["bytes"].(int),
+		Configs:  map[string]int{},
+		Types:    map[string]int{},
+		Checks:   map[string]*checkstat{},
+		Crosstab: map[string]*crosscell{},
+		Pairs:    map[string]*crosscell{},
+		Failures: append([]failcase{}, failures...),
+	}
+	for name, stat := range checkstats {
+		copied := *stat
+		copied.Choices = map[string]int{}
+		for choice, n := range stat.Choices {
+			copied.Choices[choice] = n
+		}
+		r.Checks[name] = &copied
+	}
+	for choice, cell := range crosstab {
+		copied := *cell
+		r.Crosstab[choice] = &copied
+	}
+	for p, cell := range paircover {
+		copied := *cell
+		r.Pairs[p.String()] = &copied
+	}
+	for _, key := range reportConfigs {
+		r.Configs[key] = statistics[key].(int)
+	}
+	for _, key := range reportTypes {
+		r.Types[key] = statistics[key].(int)
+	}
+	return r
+}
+
+// writeReport write run report as "json" or "junit" xml into filename.
+func writeReport(kind, filename string, elapsed time.Duration) {
+	r := makeReport(elapsed)
+
+	var data []byte
+	var err error
+	switch kind {
+	case "json":
+		if filename == "" {
+			filename = "report.json"
+		}
+		data, err = json.MarshalIndent(r, "", "  ")
+	case "junit":
+		if filename == "" {
+			filename = "report.xml"
+		}
+		data, err = xml.MarshalIndent(r.junit(), "", "  ")
+		data = append([]byte(xml.Header), data...)
+	default:
+		log.Fatalf("unknown report %q, expected json or junit", kind)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	write("report : %v\n", filename)
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       float64         `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value int    `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string         `xml:"name,attr"`
+	Classname string         `xml:"classname,attr"`
+	Time      float64        `xml:"time,attr"`
+	Failures  []junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junit report has a testcase for every check, with a failure for
+// every failing input of that check.
+func (r *report) junit() junitSuites {
+	suite := junitSuite{Name: r.Tool, Time: r.Elapsed}
+	for _, key := range reportConfigs {
+		property := junitProperty{Name: key, Value: r.Configs[key]}
+		suite.Properties = append(suite.Properties, property)
+	}
+	for _, key := range reportTypes {
+		property := junitProperty{Name: key, Value: r.Types[key]}
+		suite.Properties = append(suite.Properties, property)
+	}
+
+	names := []string{}
+	for name := range r.Checks {
+		names = append(names, name)
+	}
+	for _, fc := range r.Failures {
+		if _, ok := r.Checks[fc.Check]; !ok {
+			names = append(names, fc.Check)
+			r.Checks[fc.Check] = &checkstat{}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tc := junitCase{Name: name, Classname: r.Tool}
+		for _, fc := range r.Failures {
+			if fc.Check != name {
+				continue
+			}
+			data, _ := json.Marshal(fc)
+			failure := junitFailure{Message: fc.Error, Text: string(data)}
+			tc.Failures = append(tc.Failures, failure)
+		}
+		suite.Tests++
+		if len(tc.Failures) > 0 {
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	return junitSuites{Suites: []junitSuite{suite}}
+}
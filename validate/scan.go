@@ -0,0 +1,156 @@
+package main
+
+import "fmt"
+import "path/filepath"
+import "runtime"
+import "strings"
+import "io/ioutil"
+import "log"
+
+// scanchains are round-trips every scan_valid line must survive.
+var scanchains = []string{
+	"json2cbor2json", "json2collate2json",
+	"json2value2cbor", "json2value2collate",
+}
+
+// scanConfigs are all number kinds and space kinds, in lenient and
+// strict mode, with rest of the config left to its defaults.
+func scanConfigs() []cfgparams {
+	params := []cfgparams{}
+	for _, nk := range []string{"smart", "float"} {
+		for _, ws := range []string{"ansi", "unicode"} {
+			for _, strict := range []bool{false, true} {
+				params = append(params, cfgparams{
+					NumberKind: nk, SpaceKind: ws, Container: "stream",
+					Strict: strict,
+				})
+			}
+		}
+	}
+	return params
+}
+
+func strictness(params cfgparams) string {
+	if params.Strict {
+		return "strict"
+	}
+	return "lenient"
+}
+
+// validateScan run scanner conformance on testdata/scan_valid,
+// testdata/scan_invalid and testdata/scan_lenient, and print a table
+// of per-line result.
+func validateScan(testdata string) {
+	write("%-12v %4v  %-5v %-7v %-7v  %-6v  %v\n",
+		"file", "line", "num", "space", "mode", "result", "input / detail")
+	checks := map[string]func(cfgparams, string) (bool, string){
+		"scan_valid":   scanValid,
+		"scan_invalid": scanInvalid,
+		"scan_lenient": scanLenient,
+	}
+	for _, name := range []string{"scan_valid", "scan_invalid", "scan_lenient"} {
+		lines := readScanfile(filepath.Join(testdata, name))
+		for i, line := range lines {
+			for _, params := range scanConfigs() {
+				ok, detail := checks[name](params, line)
+				result := "pass"
+				if ok {
+					incrparam("pass", 1)
+				} else {
+					result = "fail"
+					incrparam("fail", 1)
+				}
+				fmsg := "%-12v %4v  %-5v %-7v %-7v  %-6v  %q %v\n"
+				write(fmsg, name, i+1, params.NumberKind, params.SpaceKind,
+					strictness(params), result, line, detail)
+			}
+		}
+	}
+}
+
+// scanValid line must parse into a value without any left over text,
+// and round-trip through cbor and collate.
+func scanValid(params cfgparams, line string) (ok bool, detail string) {
+	config := params.config()
+	class, remaining := scanclassify(params, line)
+	if class != "accepted" {
+		return false, class
+	} else if strings.TrimSpace(remaining) != "" {
+		return false, fmt.Sprintf("left over %q", remaining)
+	}
+	for _, name := range scanchains {
+		c, err := parseChain(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runChain(config, []byte(line), c); err != nil {
+			return false, fmt.Sprintf("%v: %v", c, err)
+		}
+	}
+	return true, ""
+}
+
+// scanInvalid line must fail with a clean error from gson, runtime
+// panics, accepting the line or part of the line are failures.
+func scanInvalid(params cfgparams, line string) (ok bool, detail string) {
+	class, remaining := scanclassify(params, line)
+	switch class {
+	case "error":
+		return true, ""
+	case "accepted":
+		if strings.TrimSpace(remaining) != "" {
+			return false, fmt.Sprintf("truncated, left over %q", remaining)
+		}
+	}
+	return false, class
+}
+
+// scanLenient line is valid JSON in lenient mode but invalid in strict
+// mode, strict config must reject it and lenient config must accept it.
+func scanLenient(params cfgparams, line string) (ok bool, detail string) {
+	class, remaining := scanclassify(params, line)
+	switch {
+	case params.Strict && class == "error":
+		return true, ""
+	case !params.Strict && class == "accepted":
+		if strings.TrimSpace(remaining) != "" {
+			return false, fmt.Sprintf("left over %q", remaining)
+		}
+		return true, ""
+	}
+	return false, class
+}
+
+// scanclassify parse line with Json.Tovalue and classify the outcome
+// as, "accepted", "error" for errors raised by gson and "panic: ..."
+// for golang runtime errors.
+func scanclassify(params cfgparams, line string) (class, remaining string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(runtime.Error); ok {
+				class = fmt.Sprintf("panic: %v", err)
+				return
+			}
+			class = "error"
+		}
+	}()
+	rem, _ := params.config().NewJson([]byte(line)).Tovalue()
+	if rem != nil {
+		remaining = string(rem.Bytes())
+	}
+	return "accepted", remaining
+}
+
+func readScanfile(filename string) []string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,303 @@
+package main
+
+import "bytes"
+import "regexp"
+import "strings"
+import "unicode/utf8"
+
+import "github.com/bnclabs/gson"
+
+// jsonnode is a JSON text parsed just enough to be shrunk. Scalars are
+// kept as the original text so that numbers are not re-formatted, and
+// strings are kept as a list of units, where an escape sequence is a
+// single unit.
+type jsonnode struct {
+	kind  byte // 'l' literal, 'n' number, 's' string, 'a' array, 'o' object
+	text  string
+	units []string
+	keys  []*jsonnode
+	items []*jsonnode
+}
+
+func (node *jsonnode) render(buf *bytes.Buffer) {
+	switch node.kind {
+	case 'l', 'n':
+		buf.WriteString(node.text)
+	case 's':
+		buf.WriteByte('"')
+		for _, unit := range node.units {
+			buf.WriteString(unit)
+		}
+		buf.WriteByte('"')
+	case 'a':
+		buf.WriteByte('[')
+		for i, item := range node.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			item.render(buf)
+		}
+		buf.WriteByte(']')
+	case 'o':
+		buf.WriteByte('{')
+		for i, item := range node.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			node.keys[i].render(buf)
+			buf.WriteByte(':')
+			item.render(buf)
+		}
+		buf.WriteByte('}')
+	}
+}
+
+// shrink minimizes JSON text, removing array elements, object
+// properties, string characters and number digits, for as long as
+// fails(text) remains true. If input cannot be parsed or its
+// normalized form does not fail, input is returned as is.
+func shrink(input string, fails func(string) bool) string {
+	root, rest, ok := parseNode(input)
+	if !ok || strings.TrimSpace(rest) != "" {
+		return input
+	}
+	render := func() string {
+		var buf bytes.Buffer
+		root.render(&buf)
+		return buf.String()
+	}
+	if !fails(render()) {
+		return input
+	}
+
+	for {
+		before := render()
+		shrinkNode(root, func() bool { return fails(render()) })
+		if after := render(); after == before {
+			return after
+		}
+	}
+}
+
+// shrinkNode shrinks node and its children in pre-order, test
+// returns whether the document, with the current state of node,
+// still fails.
+func shrinkNode(node *jsonnode, test func() bool) {
+	switch node.kind {
+	case 'n':
+		text, digits := node.text, []int{}
+		for i := 0; i < len(text); i++ {
+			if c := text[i]; c >= '0' && c <= '9' {
+				digits = append(digits, i)
+			}
+		}
+		accepted := text
+		ddmin(len(digits), func(keep []int) bool {
+			drop := make(map[int]bool)
+			for _, i := range digits {
+				drop[i] = true
+			}
+			for _, k := range keep {
+				delete(drop, digits[k])
+			}
+			var buf bytes.Buffer
+			for i := 0; i < len(text); i++ {
+				if !drop[i] {
+					buf.WriteByte(text[i])
+				}
+			}
+			if !jsonnumber.Match(buf.Bytes()) {
+				return false
+			}
+			if node.text = buf.String(); test() {
+				accepted = node.text
+				return true
+			}
+			node.text = accepted
+			return false
+		})
+
+	case 's':
+		units, accepted := node.units, node.units
+		ddmin(len(units), func(keep []int) bool {
+			node.units = make([]string, 0, len(keep))
+			for _, k := range keep {
+				node.units = append(node.units, units[k])
+			}
+			if test() {
+				accepted = node.units
+				return true
+			}
+			node.units = accepted
+			return false
+		})
+
+	case 'a', 'o':
+		keys, items := node.keys, node.items
+		akeys, aitems := keys, items
+		ddmin(len(items), func(keep []int) bool {
+			node.items = make([]*jsonnode, 0, len(keep))
+			if node.kind == 'o' {
+				node.keys = make([]*jsonnode, 0, len(keep))
+			}
+			for _, k := range keep {
+				node.items = append(node.items, items[k])
+				if node.kind == 'o' {
+					node.keys = append(node.keys, keys[k])
+				}
+			}
+			if test() {
+				akeys, aitems = node.keys, node.items
+				return true
+			}
+			node.keys, node.items = akeys, aitems
+			return false
+		})
+		for _, item := range node.items {
+			shrinkNode(item, test)
+		}
+	}
+}
+
+// ddmin removes chunks of items, starting with half the items and
+// halving the chunk size down to single items, for as long as test
+// accepts the remaining items. test is called with the indices of
+// items to keep and must leave the state as is when it returns false.
+func ddmin(n int, test func(keep []int) bool) {
+	keep := make([]int, n)
+	for i := range keep {
+		keep[i] = i
+	}
+	for chunk := (n + 1) / 2; chunk >= 1 && len(keep) > 0; chunk /= 2 {
+		for start := 0; start < len(keep); {
+			end := start + chunk
+			if end > len(keep) {
+				end = len(keep)
+			}
+			candidate := make([]int, 0, len(keep)-(end-start))
+			candidate = append(candidate, keep[:start]...)
+			candidate = append(candidate, keep[end:]...)
+			if test(candidate) {
+				keep = candidate
+			} else {
+				start = end
+			}
+		}
+	}
+}
+
+var jsonnumber = regexp.MustCompile(
+	`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func parseNode(txt string) (*jsonnode, string, bool) {
+	txt = strings.TrimLeft(txt, " \t\r\n")
+	if txt == "" {
+		return nil, txt, false
+	}
+	switch c := txt[0]; {
+	case c == '"':
+		return parseString(txt)
+	case c == '[':
+		node := &jsonnode{kind: 'a'}
+		txt = strings.TrimLeft(txt[1:], " \t\r\n")
+		if strings.HasPrefix(txt, "]") {
+			return node, txt[1:], true
+		}
+		for {
+			item, rest, ok := parseNode(txt)
+			if !ok {
+				return nil, txt, false
+			}
+			node.items = append(node.items, item)
+			rest = strings.TrimLeft(rest, " \t\r\n")
+			if strings.HasPrefix(rest, "]") {
+				return node, rest[1:], true
+			} else if !strings.HasPrefix(rest, ",") {
+				return nil, rest, false
+			}
+			txt = rest[1:]
+		}
+	case c == '{':
+		node := &jsonnode{kind: 'o'}
+		txt = strings.TrimLeft(txt[1:], " \t\r\n")
+		if strings.HasPrefix(txt, "}") {
+			return node, txt[1:], true
+		}
+		for {
+			key, rest, ok := parseString(strings.TrimLeft(txt, " \t\r\n"))
+			if !ok {
+				return nil, txt, false
+			}
+			rest = strings.TrimLeft(rest, " \t\r\n")
+			if !strings.HasPrefix(rest, ":") {
+				return nil, rest, false
+			}
+			item, rest, ok := parseNode(rest[1:])
+			if !ok {
+				return nil, rest, false
+			}
+			node.keys = append(node.keys, key)
+			node.items = append(node.items, item)
+			rest = strings.TrimLeft(rest, " \t\r\n")
+			if strings.HasPrefix(rest, "}") {
+				return node, rest[1:], true
+			} else if !strings.HasPrefix(rest, ",") {
+				return nil, rest, false
+			}
+			txt = rest[1:]
+		}
+	default:
+		for _, lit := range []string{"null", "true", "false"} {
+			if strings.HasPrefix(txt, lit) {
+				return &jsonnode{kind: 'l', text: lit}, txt[len(lit):], true
+			}
+		}
+		end := strings.IndexAny(txt, " \t\r\n,]}")
+		if end < 0 {
+			end = len(txt)
+		}
+		return &jsonnode{kind: 'n', text: txt[:end]}, txt[end:], end > 0
+	}
+}
+
+func parseString(txt string) (*jsonnode, string, bool) {
+	if !strings.HasPrefix(txt, `"`) {
+		return nil, txt, false
+	}
+	node := &jsonnode{kind: 's', units: []string{}}
+	for i := 1; i < len(txt); {
+		switch txt[i] {
+		case '"':
+			return node, txt[i+1:], true
+		case '\\':
+			n := 2
+			if i+1 < len(txt) && txt[i+1] == 'u' {
+				n = 6
+			}
+			if i+n > len(txt) {
+				return nil, txt, false
+			}
+			node.units = append(node.units, txt[i:i+n])
+			i += n
+		default:
+			_, n := utf8.DecodeRuneInString(txt[i:])
+			node.units = append(node.units, txt[i:i+n])
+			i += n
+		}
+	}
+	return nil, txt, false
+}
+
+// chainFails returns a predicate for shrink, that is true for as long
+// as chain c fails on the input under config. Inputs that do not parse
+// into a reference value are not failures.
+func chainFails(config *gson.Config, c chain) func(string) bool {
+	return func(input string) (fails bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				fails = false
+			}
+		}()
+		return runChain(config, []byte(input), c) != nil
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "strings"
+import "testing"
+
+func TestShrink(t *testing.T) {
+	input := `{"a": [1, 2, 37, "xyz"], "b": {"c": "pqrxs"}, "d": null}`
+	fails := func(s string) bool {
+		return strings.Contains(s, "7") && strings.Contains(s, "x")
+	}
+	ref := `{"a":[7,"x"]}`
+	if out := shrink(input, fails); out != ref {
+		t.Errorf("expected %v, got %v", ref, out)
+	}
+}
+
+func TestShrinkNumber(t *testing.T) {
+	fails := func(s string) bool { return strings.Contains(s, "5") }
+	for input, ref := range map[string]string{
+		"-12.5e+10": "-2.5e+0",
+		"[105]":     "[5]",
+		"1.25":      "1.5",
+	} {
+		if out := shrink(input, fails); out != ref {
+			t.Errorf("for %v expected %v, got %v", input, ref, out)
+		}
+	}
+}
+
+func TestShrinkInvalid(t *testing.T) {
+	fails := func(s string) bool { return true }
+	input := `[1, 2`
+	if out := shrink(input, fails); out != input {
+		t.Errorf("expected %v, got %v", input, out)
+	}
+}
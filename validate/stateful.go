@@ -0,0 +1,208 @@
+package main
+
+import "encoding/json"
+import "fmt"
+import "math/rand"
+import "path"
+import "runtime"
+import "sort"
+import "strconv"
+
+import "github.com/bnclabs/gson"
+
+// stateop is a single pointer operation in a stateful sequence.
+type stateop struct {
+	Op      string      `json:"op"`
+	Pointer string      `json:"pointer"`
+	Item    interface{} `json:"item,omitempty"`
+}
+
+func (op stateop) String() string {
+	if op.Op == "get" || op.Op == "delete" {
+		return fmt.Sprintf("%v %q", op.Op, op.Pointer)
+	}
+	item, _ := json.Marshal(op.Item)
+	return fmt.Sprintf("%v %q %s", op.Op, op.Pointer, item)
+}
+
+// statecase is a saved stateful failure, the starting document as JSON
+// text followed by the operations applied on it.
+type statecase struct {
+	Doc string    `json:"doc"`
+	Ops []stateop `json:"ops"`
+}
+
+// validateStateful apply a random sequence of nops pointer operations
+// on every generated document, held as Value, Cbor and golang model at
+// the same time, checking after every step that all three agree.
+func validateStateful(nops int) {
+	_, filename, _, _ := runtime.Caller(0)
+	prodfile := path.Join(path.Dir(filename), "2i.json.prod")
+	count := options.count
+	if options.doc >= 0 {
+		count = options.doc + 1
+	}
+	ch := generateJSON(prodfile, options.seed, count)
+
+	doc := 0
+	for jsonstr := range ch {
+		if options.doc < 0 || doc == options.doc {
+			incrparam("docs", 1)
+			validateOps(doc, jsonstr, nops)
+		}
+		doc++
+	}
+}
+
+func validateOps(doc int, jsonstr string, nops int) {
+	mrand := rand.New(rand.NewSource(docseed(options.seed, doc)))
+	config, params := makeConfig(mrand)
+	// TODO: cbor pointer operations are only supported with Stream.
+	params.Container = "stream"
+	config = params.config()
+
+	// root shall be a container, scalar documents start empty.
+	_, value := config.NewJson([]byte(jsonstr)).Tovalue()
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+	default:
+		jsonstr = []string{"[]", "{}"}[mrand.Intn(2)]
+	}
+
+	sc := statecase{Doc: jsonstr}
+	d := newStatedoc(config, jsonstr)
+	var err error
+	for i := 0; i < nops && err == nil; i++ {
+		op := randomOp(mrand, d.model)
+		sc.Ops = append(sc.Ops, op)
+		err = d.apply(op.Op, op.Pointer, op.Item)
+	}
+	bookcheck("stateful", params, jsonstr, err)
+	if err != nil {
+		incrparam("fail", 1)
+		printFailure(config, "fail stateful: %v\njson: %v\n", err, jsonstr)
+		for i, op := range sc.Ops {
+			write("  %4v %v\n", i+1, op)
+		}
+		write("reproduce: %v\n\n", reproducer(doc))
+		data, _ := json.Marshal(sc)
+		saveFailure(params, "stateful", string(data), "", err)
+		return
+	}
+	incrparam("pass", 1)
+	verbosef("stateful %v ops ... ok\n", len(sc.Ops))
+}
+
+func newStatedoc(config *gson.Config, jsonstr string) *opdoc {
+	_, value := config.NewJson([]byte(jsonstr)).Tovalue()
+	return newOpdoc(config, gson.Fixtojson(config, value))
+}
+
+// replayStateful re-apply the operations of a saved stateful failure.
+func replayStateful(params cfgparams, input string) error {
+	var sc statecase
+	if err := json.Unmarshal([]byte(input), &sc); err != nil {
+		return err
+	}
+	d := newStatedoc(params.config(), sc.Doc)
+	for _, op := range sc.Ops {
+		if err := d.apply(op.Op, op.Pointer, op.Item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// randomOp pick an operation that is valid on model, set may replace
+// a container with a scalar and vice versa.
+func randomOp(mrand *rand.Rand, model interface{}) stateop {
+	items, arrays, objects := []string{}, []string{}, []string{}
+	var walk func(prefix string, doc interface{})
+	walk = func(prefix string, doc interface{}) {
+		if prefix != "" {
+			items = append(items, prefix)
+		}
+		switch v := doc.(type) {
+		case []interface{}:
+			arrays = append(arrays, prefix)
+			for i, item := range v {
+				walk(prefix+"/"+strconv.Itoa(i), item)
+			}
+		case map[string]interface{}:
+			objects = append(objects, prefix)
+			keys := []string{}
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys) // same seed shall pick the same ops.
+			for _, key := range keys {
+				walk(prefix+"/"+escapePointer(key), v[key])
+			}
+		}
+	}
+	walk("", model)
+	pick := func(pointers []string) string {
+		return pointers[mrand.Intn(len(pointers))]
+	}
+
+	for {
+		switch mrand.Intn(5) {
+		case 0:
+			return stateop{Op: "get", Pointer: pick(append(items, ""))}
+		case 1:
+			if len(items) > 0 {
+				item := randomItem(mrand, 2)
+				return stateop{Op: "set", Pointer: pick(items), Item: item}
+			}
+		case 2:
+			if len(objects) > 0 {
+				keys := []string{"a", "", "~", "/", "0", "-", "a/b~c"}
+				key := keys[mrand.Intn(len(keys))]
+				ptr := pick(objects) + "/" + escapePointer(key)
+				item := randomItem(mrand, 2)
+				return stateop{Op: "set", Pointer: ptr, Item: item}
+			}
+		case 3:
+			if len(arrays) > 0 {
+				item := randomItem(mrand, 2)
+				ptr := pick(arrays) + "/-"
+				return stateop{Op: "append", Pointer: ptr, Item: item}
+			}
+		case 4:
+			if len(items) > 0 {
+				return stateop{Op: "delete", Pointer: pick(items)}
+			}
+		}
+	}
+}
+
+// randomItem of nesting depth at most depth.
+func randomItem(mrand *rand.Rand, depth int) interface{} {
+	n := 7
+	if depth == 0 {
+		n = 5
+	}
+	switch mrand.Intn(n) {
+	case 0:
+		return nil
+	case 1:
+		return mrand.Intn(2) == 0
+	case 2:
+		return float64(mrand.Intn(2000) - 1000)
+	case 3:
+		return mrand.NormFloat64() * 1000
+	case 4:
+		return []string{"", "a", "~0/~1", "hello world"}[mrand.Intn(4)]
+	case 5:
+		arr := []interface{}{}
+		for i := mrand.Intn(3); i > 0; i-- {
+			arr = append(arr, randomItem(mrand, depth-1))
+		}
+		return arr
+	}
+	m := map[string]interface{}{}
+	for i := mrand.Intn(3); i > 0; i-- {
+		m[fmt.Sprintf("k%v", i)] = randomItem(mrand, depth-1)
+	}
+	return m
+}
@@ -0,0 +1,173 @@
+package main
+
+import "fmt"
+import "sort"
+
+// checkstat count the outcome of a check, a check is either a
+// transform chain or one of the pointer or strict verifications.
+type checkstat struct {
+	Attempts int `json:"attempts"`
+	Pass     int `json:"pass"`
+	Fail     int `json:"fail"`
+	Panics   int `json:"panics"`
+	Bytes    int `json:"bytes"`
+	// Choices count failures for every config choice, like
+	// "container:lenprefix".
+	Choices map[string]int `json:"choices,omitempty"`
+}
+
+var checkstats = map[string]*checkstat{}
+
+// crosscell count documents validated under a config choice and how
+// many of them failed.
+type crosscell struct {
+	Docs int `json:"docs"`
+	Fail int `json:"fail"`
+}
+
+// crosstab of failures against config choices.
+var crosstab = map[string]*crosscell{}
+
+// paircover of failures against pairs of config choices, from any two
+// dimensions, a pair missing here was never validated.
+var paircover = map[pair]*crosscell{}
+
+// bookcheck count the outcome of check on input under params.
+func bookcheck(check string, params cfgparams, input string, err error) {
+	statrw.Lock()
+	defer statrw.Unlock()
+
+	stat, ok := checkstats[check]
+	if !ok {
+		stat = &checkstat{Choices: map[string]int{}}
+		checkstats[check] = stat
+	}
+	stat.Attempts++
+	stat.Bytes += len(input)
+	if err == nil {
+		stat.Pass++
+		return
+	}
+	stat.Fail++
+	if _, ok := err.(*panicError); ok {
+		stat.Panics++
+	}
+	for _, choice := range params.choices() {
+		stat.Choices[choice]++
+	}
+}
+
+// bookcrosstab count a document validated under params.
+func bookcrosstab(params cfgparams, err error) {
+	statrw.Lock()
+	defer statrw.Unlock()
+
+	for _, choice := range params.choices() {
+		cell, ok := crosstab[choice]
+		if !ok {
+			cell = &crosscell{}
+			crosstab[choice] = cell
+		}
+		cell.Docs++
+		if err != nil {
+			cell.Fail++
+		}
+	}
+	for _, p := range pairsof(combinationOf(params)) {
+		cell, ok := paircover[p]
+		if !ok {
+			cell = &crosscell{}
+			paircover[p] = cell
+		}
+		cell.Docs++
+		if err != nil {
+			cell.Fail++
+		}
+	}
+}
+
+// choices made for params, one for every dimension in the order of
+// dimensions, as "name:choice".
+func (params cfgparams) choices() []string {
+	return []string{
+		"numberkind:" + params.NumberKind,
+		"spacekind:" + params.SpaceKind,
+		"container:" + params.Container,
+		fmt.Sprintf("arraylenprefix:%v", params.ArrayLen),
+		fmt.Sprintf("propertylenprefix:%v", params.PropertyLen),
+		fmt.Sprintf("missing:%v", params.Missing),
+		fmt.Sprintf("strict:%v", params.Strict),
+	}
+}
+
+// printChecks print per check metrics and, if there were failures, the
+// failures against every config choice, caller must hold statrw.
+func printChecks() {
+	names := []string{}
+	for name := range checkstats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stat := checkstats[name]
+		fmsg := "%-36v: attempts %v, pass %v, fail %v, panics %v, bytes %v\n"
+		write(fmsg, name, stat.Attempts, stat.Pass, stat.Fail, stat.Panics,
+			stat.Bytes)
+	}
+
+	printPaircover()
+	if statistics["fail"].(int) == 0 {
+		return
+	}
+	choices := []string{}
+	for choice := range crosstab {
+		choices = append(choices, choice)
+	}
+	sort.Strings(choices)
+	write("failures by config choice:\n")
+	for _, choice := range choices {
+		cell := crosstab[choice]
+		rate := float64(cell.Fail) * 100 / float64(cell.Docs)
+		fmsg := "  %-24v: docs %v, fail %v (%.1f%%)\n"
+		write(fmsg, choice, cell.Docs, cell.Fail, rate)
+	}
+	for _, name := range names {
+		stat := checkstats[name]
+		if stat.Fail == 0 {
+			continue
+		}
+		row := []string{}
+		for _, choice := range choices {
+			if n := stat.Choices[choice]; n > 0 {
+				row = append(row, fmt.Sprintf("%v %v", choice, n))
+			}
+		}
+		write("  %v: %v\n", name, row)
+	}
+}
+
+// printPaircover print how many of the value pairs, that a pairwise
+// matrix covers, were validated and list the ones that were not, along
+// with the pairs that failed, caller must hold statrw.
+func printPaircover() {
+	if len(paircover) == 0 {
+		return
+	}
+	pairs, uncovered := allPairs(), []string{}
+	for _, p := range pairs {
+		if _, ok := paircover[p]; !ok {
+			uncovered = append(uncovered, p.String())
+		}
+	}
+	fmsg := "pairwise coverage: %v of %v value pairs\n"
+	write(fmsg, len(pairs)-len(uncovered), len(pairs))
+	for _, p := range uncovered {
+		write("  not covered %v\n", p)
+	}
+	for _, p := range pairs {
+		if cell, ok := paircover[p]; ok && cell.Fail > 0 {
+			fmsg := "  %-44v: docs %v, fail %v\n"
+			write(fmsg, p, cell.Docs, cell.Fail)
+		}
+	}
+}
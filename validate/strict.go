@@ -0,0 +1,28 @@
+package main
+
+import "fmt"
+import "strings"
+
+// verifyStrict parse input under strict and lenient variants of params,
+// input rejected by strict parsing must be accepted by lenient parsing.
+// Return whether strict parsing rejected the input.
+func verifyStrict(params cfgparams, input string) (rejected bool, err error) {
+	strict, lenient := params, params
+	strict.Strict, lenient.Strict = true, false
+
+	switch class, _ := scanclassify(strict, input); class {
+	case "accepted":
+		return false, nil
+	case "error":
+	default:
+		return true, fmt.Errorf("strict: %v", class)
+	}
+	class, remaining := scanclassify(lenient, input)
+	if class != "accepted" {
+		return true, fmt.Errorf("rejected by strict, lenient: %v", class)
+	} else if strings.TrimSpace(remaining) != "" {
+		fmsg := "rejected by strict, lenient: left over %q"
+		return true, fmt.Errorf(fmsg, remaining)
+	}
+	return true, nil
+}
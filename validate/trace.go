@@ -0,0 +1,205 @@
+package main
+
+import "encoding/hex"
+import "fmt"
+import "math"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+import "github.com/bnclabs/gson"
+
+// tracestage is a stage of a chain as recorded by traceChain.
+type tracestage struct {
+	name  string // chain upto this stage, like json2cbor.
+	data  string // encoded bytes, rendered for the representation.
+	value interface{}
+	diff  string // difference with reference value, if any.
+	err   error
+}
+
+// traceChain apply chain c on input JSON text recording the bytes and
+// decoded value after every hop, trace stops at the first hop that
+// panics.
+func traceChain(config *gson.Config, data []byte, c chain) []tracestage {
+	ref := reference(config, data)
+	in := &stage{kind: reprJSON, jsn: config.NewJson(data)}
+	stages := []tracestage{traceStage(config, chain{}, in, ref)}
+	for i, e := range c {
+		out, err := traceHop(config, e, in)
+		if err != nil {
+			name := c[:i+1].String()
+			stages = append(stages, tracestage{name: name, err: err})
+			break
+		}
+		stages = append(stages, traceStage(config, c[:i+1], out, ref))
+		in = out
+	}
+	return stages
+}
+
+func traceHop(config *gson.Config, e *edge, in *stage) (out *stage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return e.convert(config, in), nil
+}
+
+func traceStage(
+	config *gson.Config, c chain, s *stage, ref interface{}) (ts tracestage) {
+
+	ts.name = c.String()
+	switch s.kind {
+	case reprJSON:
+		ts.data = string(s.jsn.Bytes())
+	case reprValue:
+		ts.data = "-"
+	case reprCbor:
+		data := s.cbr.Bytes()
+		ts.data = hex.EncodeToString(data) + "  " + cborDiag(data)
+	case reprCollate:
+		ts.data = hex.EncodeToString(s.clt.Bytes())
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			ts.err = fmt.Errorf("decode panic: %v", r)
+		}
+	}()
+	ts.value = gson.Fixtojson(config, s.tovalue())
+	if err := verifyobj(config, ref, ts.value); err != nil {
+		ts.diff = err.Error()
+	}
+	return ts
+}
+
+// printTrace print stages side by side, a row for every hop with
+// columns for stage, bytes, decoded value and diff, marking the first
+// stage that differs from the reference.
+func printTrace(stages []tracestage) {
+	for _, row := range formatTrace(stages) {
+		write("%v\n", row)
+	}
+	write("\n")
+}
+
+// formatTrace render stages as rows of aligned columns, headed by the
+// column names. The first stage with a diff or an error is marked "=>".
+func formatTrace(stages []tracestage) []string {
+	cells := [][]string{{"stage", "bytes", "value", "diff"}}
+	marks := []string{"  "}
+	marked := false
+	for _, ts := range stages {
+		mark := "  "
+		if !marked && (ts.diff != "" || ts.err != nil) {
+			mark, marked = "=>", true
+		}
+		value, diff := fmt.Sprintf("%v", ts.value), ts.diff
+		if ts.err != nil {
+			value, diff = "-", "error: "+ts.err.Error()
+		}
+		cells = append(cells, []string{ts.name, ts.data, value, diff})
+		marks = append(marks, mark)
+	}
+	widths := make([]int, 4)
+	for _, row := range cells {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	rows := []string{}
+	for r, row := range cells {
+		cols := []string{}
+		for i, cell := range row {
+			pad := widths[i] - utf8.RuneCountInString(cell)
+			cols = append(cols, cell+strings.Repeat(" ", pad))
+		}
+		line := marks[r] + " " + strings.Join(cols, " | ")
+		rows = append(rows, strings.TrimRight(line, " "))
+	}
+	return rows
+}
+
+// cborDiag render cbor in RFC 8949 diagnostic notation, on malformed
+// input the rendering of the current item is replaced by the error.
+func cborDiag(data []byte) (diag string) {
+	d := &cborDecoder{data: data}
+	var buf []string
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(cborError); ok {
+				buf = append(buf, "<"+err.Error()+">")
+				diag = strings.Join(buf, " ")
+				return
+			}
+			panic(r)
+		}
+	}()
+	for d.off < len(d.data) {
+		buf = append(buf, d.diag())
+	}
+	return strings.Join(buf, " ")
+}
+
+func (d *cborDecoder) diag() string {
+	major, info, arg, indefinite := d.head()
+	items := func(n uint64, item func() string) []string {
+		out := []string{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			if indefinite && d.isbreak() {
+				break
+			}
+			out = append(out, item())
+		}
+		return out
+	}
+	prefix := ""
+	if indefinite {
+		prefix = "_ "
+	}
+	switch major {
+	case 0:
+		return strconv.FormatUint(arg, 10)
+	case 1:
+		return "-1-" + strconv.FormatUint(arg, 10)
+	case 2, 3:
+		if indefinite {
+			chunks := items(0, d.diag)
+			return "(_ " + strings.Join(chunks, ", ") + ")"
+		} else if s := d.read(arg); major == 2 {
+			return "h'" + hex.EncodeToString(s) + "'"
+		} else {
+			return strconv.Quote(string(s))
+		}
+	case 4:
+		return "[" + prefix + strings.Join(items(arg, d.diag), ", ") + "]"
+	case 5:
+		property := func() string { return d.diag() + ": " + d.diag() }
+		return "{" + prefix + strings.Join(items(arg, property), ", ") + "}"
+	case 6:
+		return fmt.Sprintf("%v(%v)", arg, d.diag())
+	}
+	switch info {
+	case 20:
+		return "false"
+	case 21:
+		return "true"
+	case 22:
+		return "null"
+	case 23:
+		return "undefined"
+	case 25:
+		return strconv.FormatFloat(halffloat(uint16(arg)), 'g', -1, 64) + "_1"
+	case 26:
+		f := float64(math.Float32frombits(uint32(arg)))
+		return strconv.FormatFloat(f, 'g', -1, 32) + "_2"
+	case 27:
+		return strconv.FormatFloat(math.Float64frombits(arg), 'g', -1, 64)
+	case 31:
+		return "<break>"
+	}
+	return fmt.Sprintf("simple(%v)", arg)
+}
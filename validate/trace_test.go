@@ -0,0 +1,60 @@
+package main
+
+import "encoding/hex"
+import "fmt"
+import "strings"
+import "testing"
+
+func TestCborDiag(t *testing.T) {
+	testcases := map[string]string{
+		"9f018202039f0405ffff":       "[_ 1, [2, 3], [_ 4, 5]]",
+		"bf6346756ef563416d7421ff":   `{_ "Fun": true, "Amt": -1-1}`,
+		"7f657374726561646d696e67ff": `(_ "strea", "ming")`,
+		"c249010000000000000000":     "2(h'010000000000000000')",
+		"f93e00fb3ff199999999999af6": "1.5_1 1.1 null",
+		"83010001":                   "[1, 0, 1]",
+		"8301":                       "<truncated, need 1 bytes at offset 2>",
+	}
+	for in, ref := range testcases {
+		data, _ := hex.DecodeString(in)
+		if out := cborDiag(data); out != ref {
+			t.Errorf("%v: expected %v, got %v", in, ref, out)
+		}
+	}
+}
+
+func TestFormatTrace(t *testing.T) {
+	stages := []tracestage{
+		{name: "", data: `[1]`, value: []interface{}{1.0}},
+		{name: "json2cbor", data: "8101", value: []interface{}{1.0}},
+		{name: "json2cbor,cbor2json", data: `[2]`,
+			value: []interface{}{2.0}, diff: "/0: 1 vs 2"},
+		{name: "json2cbor,cbor2json,json2value", data: "-",
+			value: []interface{}{2.0}, diff: "/0: 1 vs 2"},
+	}
+	rows := formatTrace(stages)
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %v", len(rows))
+	}
+	for i, row := range rows {
+		mark := "  "
+		if i == 3 {
+			mark = "=>"
+		}
+		if row[:2] != mark {
+			t.Errorf("row %v: expected mark %q, got %q", i, mark, row)
+		}
+	}
+	ref := "=> json2cbor,cbor2json            | [2]   | [2]   | /0: 1 vs 2"
+	if rows[3] != ref {
+		t.Errorf("expected %q, got %q", ref, rows[3])
+	}
+
+	stages[2].diff, stages[3].diff = "", ""
+	stages[3].err = fmt.Errorf("panic: boom")
+	rows = formatTrace(stages)
+	if !strings.HasPrefix(rows[4], "=>") ||
+		!strings.HasSuffix(rows[4], "| error: panic: boom") {
+		t.Errorf("expected marked error row, got %q", rows[4])
+	}
+}
@@ -16,8 +16,10 @@ import "unsafe"
 import "bytes"
 import "errors"
 import "sort"
+import "time"
 
 import "github.com/bnclabs/gson"
+import "github.com/bnclabs/gson-tools/internal/structdiff"
 import "github.com/prataprc/goparsec"
 import "github.com/prataprc/monster"
 import mcommon "github.com/prataprc/monster/common"
@@ -25,26 +27,81 @@ import mcommon "github.com/prataprc/monster/common"
 var _ = fmt.Sprintf("dummy")
 
 var options struct {
-	seed    int
-	count   int
-	input   string
-	stop    bool
-	par     int
-	genout  string
-	verbose bool
-	debug   bool
-	outfd   *os.File
+	seed       int
+	doc        int
+	count      int
+	depth      int
+	input      string
+	stop       bool
+	corpus     string
+	replay     string
+	scan       string
+	vectors    string
+	pointers   bool
+	appends    bool
+	stateful   int
+	trace      bool
+	mutate     int
+	matrix     string
+	report     string
+	reportfile string
+	timeout    time.Duration
+	maxhangs   int
+	shrink     bool
+	par        int
+	genout     string
+	verbose    bool
+	debug      bool
+	outfd      *os.File
 }
 
 func argParse() []string {
+	// failures are saved next to the source, irrespective of cwd.
+	_, filename, _, _ := runtime.Caller(0)
+	corpusdir := path.Join(path.Dir(filename), "corpus")
+
 	flag.IntVar(&options.seed, "seed", 0,
 		"random seed to monster")
+	flag.IntVar(&options.doc, "doc", -1,
+		"validate only the n-th document, as printed by a reproducer")
 	flag.IntVar(&options.count, "count", 1,
 		"number of validations")
+	flag.IntVar(&options.depth, "depth", 3,
+		"maximum number of conversions in a transform chain")
 	flag.StringVar(&options.input, "input", "",
 		"validate the supplite json string")
 	flag.BoolVar(&options.stop, "stop", false,
 		"continue after error")
+	flag.StringVar(&options.corpus, "corpus", corpusdir,
+		"directory to save failing inputs, empty string to disable")
+	flag.StringVar(&options.replay, "replay", "",
+		"replay failures saved in corpus directory or file")
+	flag.StringVar(&options.scan, "scan", "",
+		"run scanner conformance on scan_valid/scan_invalid in directory")
+	flag.StringVar(&options.vectors, "vectors", "",
+		"validate cbor encoding with RFC 8949 test vectors in file")
+	flag.BoolVar(&options.pointers, "pointers", false,
+		"run RFC 6901 pointer conformance, also on every document")
+	flag.BoolVar(&options.appends, "appenddelete", false,
+		"build and tear down every document with append, set and delete")
+	flag.IntVar(&options.stateful, "stateful", 0,
+		"number of random pointer operations per document, stateful testing")
+	flag.BoolVar(&options.trace, "trace", false,
+		"dump every stage of a failing chain")
+	flag.StringVar(&options.report, "report", "",
+		"write run report as \"json\" or \"junit\" xml")
+	flag.StringVar(&options.reportfile, "reportfile", "",
+		"file to write run report, default report.json or report.xml")
+	flag.StringVar(&options.matrix, "matrix", "",
+		"validate every document under \"full\" or \"pairwise\" config matrix")
+	flag.IntVar(&options.mutate, "mutate", 0,
+		"number of mutations per document and encoding, to fuzz decoders")
+	flag.DurationVar(&options.timeout, "timeout", 10*time.Second,
+		"time after which a decoder is considered hung")
+	flag.IntVar(&options.maxhangs, "maxhangs", 4,
+		"stop mutating once as many hung decoders are still running")
+	flag.BoolVar(&options.shrink, "shrink", true,
+		"shrink failing input to a smaller reproducer")
 	flag.IntVar(&options.par, "par", 1,
 		"number of parallel routines, applicable only with random validation")
 	flag.BoolVar(&options.verbose, "v", false,
@@ -85,8 +142,15 @@ var statistics = map[string]interface{}{
 	"propertyLenPrefix": 0,
 	"doMissing":         0,
 	"strict":            0,
+	"strictRejects":     0,
 }
 
+// failconfigs count failures for every config that failed.
+var failconfigs = map[string]int{}
+
+// failures in this run, in the order they were found.
+var failures = []failcase{}
+
 func main() {
 	argParse()
 
@@ -98,17 +162,39 @@ func main() {
 		defer options.outfd.Close()
 	}
 
+	if options.matrix != "" {
+		matrix = configMatrix(options.matrix)
+	}
+
+	start := time.Now()
 	defer func() {
 		printStatistics()
+		if options.report != "" {
+			writeReport(options.report, options.reportfile, time.Since(start))
+		}
 		if statistics["fail"].(int) > 0 {
 			os.Exit(1)
 		}
 	}()
 
-	if options.input != "" {
-		mrand := rand.New(rand.NewSource(int64(options.seed)))
+	if options.pointers {
+		validatePointers() // and with every document validated below.
+	}
+	if options.scan != "" {
+		validateScan(options.scan)
+	} else if options.vectors != "" {
+		validateVectors(options.vectors)
+	} else if options.stateful > 0 {
+		validateStateful(options.stateful)
+	} else if options.mutate > 0 {
+		validateMutations(options.mutate)
+	} else if options.replay != "" {
+		replayCorpus(options.replay)
+	} else if options.input != "" {
 		for i := 0; i < options.count; i++ {
-			validateString(mrand, options.input)
+			if options.doc < 0 || i == options.doc {
+				validateString(i, options.input)
+			}
 		}
 	} else {
 		validateRandom()
@@ -120,7 +206,29 @@ func validateRandom() (status map[string]interface{}) {
 	prodfile := path.Join(path.Dir(filename), "2i.json.prod")
 	var wg sync.WaitGroup
 	wg.Add(options.par)
-	ch := generateJSON(prodfile, options.seed, options.count)
+	count := options.count
+	if options.doc >= 0 {
+		count = options.doc + 1
+	}
+	ch := generateJSON(prodfile, options.seed, count)
+
+	// number documents in the order generated, so that a document and
+	// its config do not depend on which routine picks it up.
+	type document struct {
+		index int
+		data  string
+	}
+	docch := make(chan document, 1000)
+	go func() {
+		i := 0
+		for data := range ch {
+			if options.doc < 0 || i == options.doc {
+				docch <- document{index: i, data: data}
+			}
+			i++
+		}
+		close(docch)
+	}()
 
 	donech := make(chan bool, 1000)
 	go func() {
@@ -135,10 +243,9 @@ func validateRandom() (status map[string]interface{}) {
 
 	for n := 0; n < options.par; n++ {
 		go func(n int) {
-			mrand := rand.New(rand.NewSource(int64(options.seed)))
-			for data := range ch {
-				verbosef(fmt.Sprintf("json: %v\n", data))
-				if err := validateString(mrand, data); err != nil {
+			for doc := range docch {
+				verbosef(fmt.Sprintf("json: %v\n", doc.data))
+				if err := validateString(doc.index, doc.data); err != nil {
 					if options.stop {
 						os.Exit(1)
 					}
@@ -152,381 +259,202 @@ func validateRandom() (status map[string]interface{}) {
 	return
 }
 
-func validateString(mrand *rand.Rand, jsonstr string) (err error) {
-	config := makeConfig(mrand)
-	data := str2bytes(jsonstr)
-	jsn := config.NewJson(str2bytes(jsonstr))
-
-	_, doc := jsn.Tovalue()
-
-	defer func() { bookstats(config, jsonstr, doc, err) }()
-
-	// validate pointer ops
-	switch doc := doc.(type) {
-	case []interface{}:
-		if err = verifyValuePointers(config, doc); err != nil {
-			return
-		}
-		if err = verifyCborPointers(config, doc); err != nil {
-			fmsg := "fail verifyCborPointers: %v\njson: %v\n\n"
-			printFailure(config, fmsg, err, jsonstr)
-			return
+// validateString validate the doc-th document jsonstr under a random
+// config drawn from its sub-seed, or under every config in the matrix
+// with -matrix.
+func validateString(doc int, jsonstr string) (err error) {
+	incrparam("docs", 1)
+	defer func() {
+		if err != nil {
+			write("reproduce: %v\n", reproducer(doc))
 		}
+	}()
 
-	case map[string]interface{}:
-		if err = verifyValuePointers(config, doc); err != nil {
-			return
-		}
-		if err = verifyCborPointers(config, doc); err != nil {
-			fmsg := "fail verifyCborPointers: %v\njson: %v\n\n"
-			printFailure(config, fmsg, err, jsonstr)
-			return
-		}
-	}
-	// validate transforms
-	if err = value2json2cbor2collate(config, data); err != nil {
-		fmsg := "fail value2json2cbor2collate: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
-	}
-	if err = value2cbor2collate(config, data); err != nil {
-		fmsg := "fail value2cbor2collate: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
-	}
-	if err = value2collate(config, data); err != nil {
-		fmsg := "fail value2collate: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
-	}
-	if err = json2cbor2collate2value(config, data); err != nil {
-		fmsg := "fail json2cbor2collate2value: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
-	}
-	if err = json2collate2value(config, data); err != nil {
-		fmsg := "fail json2collate2value: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	if matrix == nil {
+		mrand := rand.New(rand.NewSource(docseed(options.seed, doc)))
+		config, params := makeConfig(mrand)
+		return validateConfig(config, params, jsonstr)
 	}
-	if err = json2value(config, data); err != nil {
-		fmsg := "fail json2value: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	for _, params := range matrix {
+		bookparams(params)
+		if e := validateConfig(params.config(), params, jsonstr); e != nil {
+			if err = e; options.stop {
+				return err
+			}
+		}
 	}
-	if err = cbor2collate2value2json(config, data); err != nil {
-		fmsg := "fail cbor2collate2value2json: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	return err
+}
+
+// docseed derive a sub-seed for the doc-th document from the run seed,
+// using splitmix64 so that neighbouring documents get unrelated seeds.
+func docseed(seed, doc int) int64 {
+	z := uint64(seed) + uint64(doc+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// reproducer is the command line to validate the doc-th document alone,
+// under the same config.
+func reproducer(doc int) string {
+	args := []string{"./validate", "-seed", fmt.Sprint(options.seed)}
+	args = append(args, "-doc", fmt.Sprint(doc))
+	if options.depth != 3 {
+		args = append(args, "-depth", fmt.Sprint(options.depth))
 	}
-	if err = cbor2value2json(config, data); err != nil {
-		fmsg := "fail cbor2value2json: %v\njson:%v \n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	if options.matrix != "" {
+		args = append(args, "-matrix", options.matrix)
 	}
-	if err = cbor2json(config, data); err != nil {
-		fmsg := "fail cbor2json: %v\njson:%v \n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	if options.stateful > 0 {
+		args = append(args, "-stateful", fmt.Sprint(options.stateful))
 	}
-	if err = collate2value2json2cbor(config, data); err != nil {
-		fmsg := "fail collate2value2json2cbor: %v\njson:%v \n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	if options.pointers {
+		args = append(args, "-pointers")
 	}
-	if err = collate2json2cbor(config, data); err != nil {
-		fmsg := "fail collate2json2cbor: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	if options.appends {
+		args = append(args, "-appenddelete")
 	}
-	if err = collate2cbor(config, data); err != nil {
-		fmsg := "fail collate2cbor: %v\njson: %v\n\n"
-		printFailure(config, fmsg, err, jsonstr)
-		return
+	if options.input != "" {
+		quoted := "'" + strings.Replace(options.input, "'", `'\''`, -1) + "'"
+		args = append(args, "-count", fmt.Sprint(doc+1), "-input", quoted)
 	}
-	return
+	return strings.Join(args, " ")
 }
 
-func value2json2cbor2collate(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
-		}
-	}()
-	// value -> json -> cbor -> collate -> value
-	_, ref := config.NewJson(data).Tovalue()
-	rval := config.NewValue(ref)
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	clt := config.NewCollate(make([]byte, 0, 1024))
-
-	value := rval.Tojson(jsn).Tocbor(cbr).Tocollate(clt).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
-	}
-	verbosef("value2json2cbor2collate ... ok\n")
-	return
-}
+func validateConfig(
+	config *gson.Config, params cfgparams, jsonstr string) (err error) {
 
-func value2cbor2collate(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
+	// inputs rejected by strict config are only checked for strictness.
+	if params.Strict {
+		rejected, err := verifyStrict(params, jsonstr)
+		if rejected || err != nil {
+			bookcheck("strict", params, jsonstr, err)
 		}
-	}()
-	// json -> value -> cbor -> collate -> value
-	_, ref := config.NewJson(data).Tovalue()
-	rval := config.NewValue(ref)
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	clt := config.NewCollate(make([]byte, 0, 1024))
-
-	value := rval.Tocbor(cbr).Tocollate(clt).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
-	}
-	verbosef("value2cbor2collate ... ok\n")
-	return
-}
-
-func value2collate(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
+		if err != nil {
+			incrparam("fail", 1)
+			printFailure(config, "fail strict: %v\njson: %v\n\n", err, jsonstr)
+			saveFailure(params, "strict", jsonstr, "", err)
+			return err
+		} else if rejected {
+			incrparam("pass", 1)
+			incrparam("strictRejects", 1)
+			return nil
 		}
-	}()
-	// json -> value -> collate -> value
-	_, ref := config.NewJson(data).Tovalue()
-	rval := config.NewValue(ref)
-	clt := config.NewCollate(make([]byte, 0, 1024))
-
-	value := rval.Tocollate(clt).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
 	}
-	verbosef("value2collate ... ok\n")
-	return
-}
 
-func json2cbor2collate2value(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
-		}
-	}()
-	// json -> value -> cbor -> collate -> value -> json -> value
-	_, ref := config.NewJson(data).Tovalue()
-	rval := config.NewValue(ref)
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	clt := config.NewCollate(make([]byte, 0, 1024))
-
-	config.NewValue(rval.Tocbor(cbr).Tocollate(clt).Tovalue()).Tojson(jsn)
-	_, value := jsn.Tovalue()
-	// verify
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
-	}
-	verbosef("json2cbor2collate2value ... ok\n")
-	return
-}
+	data := str2bytes(jsonstr)
+	jsn := config.NewJson(str2bytes(jsonstr))
 
-func json2collate2value(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
-		}
-	}()
-	// json -> collate -> value -> json -> value
-	_, ref := config.NewJson(data).Tovalue()
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	clt := config.NewCollate(make([]byte, 0, 1024))
-
-	val := config.NewValue(config.NewJson(data).Tocollate(clt).Tovalue())
-	_, value := val.Tojson(jsn).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
-	}
-	verbosef("json2collate2value ... ok\n")
-	return
-}
+	_, doc := jsn.Tovalue()
 
-func json2value(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
-		}
-	}()
-	// json -> value -> json -> value
-	_, ref := config.NewJson(data).Tovalue()
-	rval := config.NewValue(ref)
-	_, value := rval.Tojson(config.NewJson(make([]byte, 0, 1024))).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
-	}
-	verbosef("json2value ... ok\n")
-	return
-}
+	defer func() { bookstats(config, params, jsonstr, doc, err) }()
 
-func cbor2collate2value2json(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
-		}
-	}()
-	// json -> cbor -> collate -> value -> json -> cbor
-	_, ref := config.NewJson(data).Tovalue()
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	clt := config.NewCollate(make([]byte, 0, 1024))
-	cbrback := config.NewCbor(make([]byte, 0, 1024))
-
-	value := config.NewJson(data).Tocbor(cbr).Tocollate(clt).Tovalue()
-	value = config.NewValue(value).Tojson(jsn).Tocbor(cbrback).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
+	// validate against encoding/json
+	err = verifyDifferential(params, jsonstr)
+	bookcheck("differential", params, jsonstr, err)
+	if err != nil {
+		printFailure(config, "fail %v\njson: %v\n\n", err, jsonstr)
+		saveFailure(params, "differential", jsonstr, "", err)
+		return
 	}
-	verbosef("cbor2collate2value2json ... ok\n")
-	return
-}
 
-func cbor2value2json(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
-		}
-	}()
-	// json -> cbor -> value -> json -> cbor -> value
-	_, ref := config.NewJson(data).Tovalue()
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	cbrback := config.NewCbor(make([]byte, 0, 1024))
-	val := config.NewValue(config.NewJson(data).Tocbor(cbr).Tovalue())
-	value := val.Tojson(jsn).Tocbor(cbrback).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
+	// validate cbor with reference decoder
+	err = verifyCborReference(params, jsonstr)
+	bookcheck("cborReference", params, jsonstr, err)
+	if err != nil {
+		printFailure(config, "fail %v\njson: %v\n\n", err, jsonstr)
+		saveFailure(params, "cborReference", jsonstr, "", err)
+		return
 	}
-	verbosef("cbor2value2json ... ok\n")
-	return
-}
 
-func cbor2json(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
+	// validate pointer ops
+	switch doc := doc.(type) {
+	case []interface{}:
+		err = verifyValuePointers(config, doc)
+		bookcheck("verifyValuePointers", params, jsonstr, err)
+		if err != nil {
+			saveFailure(params, "verifyValuePointers", jsonstr, "", err)
+			return
+		}
+		err = verifyCborPointers(config, doc)
+		bookcheck("verifyCborPointers", params, jsonstr, err)
+		if err != nil {
+			fmsg := "fail verifyCborPointers: %v\njson: %v\n\n"
+			printFailure(config, fmsg, err, jsonstr)
+			saveFailure(params, "verifyCborPointers", jsonstr, "", err)
+			return
 		}
-	}()
-	// json -> cbor -> json -> cbor -> value
-	_, ref := config.NewJson(data).Tovalue()
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	cbrback := config.NewCbor(make([]byte, 0, 1024))
-
-	config.NewJson(data).Tocbor(cbr).Tojson(jsn).Tocbor(cbrback)
-	value := cbrback.Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
-	}
-	verbosef("cbor2json ... ok\n")
-	return
-}
 
-func collate2value2json2cbor(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
+	case map[string]interface{}:
+		err = verifyValuePointers(config, doc)
+		bookcheck("verifyValuePointers", params, jsonstr, err)
+		if err != nil {
+			saveFailure(params, "verifyValuePointers", jsonstr, "", err)
+			return
+		}
+		err = verifyCborPointers(config, doc)
+		bookcheck("verifyCborPointers", params, jsonstr, err)
+		if err != nil {
+			fmsg := "fail verifyCborPointers: %v\njson: %v\n\n"
+			printFailure(config, fmsg, err, jsonstr)
+			saveFailure(params, "verifyCborPointers", jsonstr, "", err)
+			return
 		}
-	}()
-	// json -> collate -> value -> json -> cbor -> collate -> value
-	_, ref := config.NewJson(data).Tovalue()
-	clt := config.NewCollate(make([]byte, 0, 1024))
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	cltback := config.NewCollate(make([]byte, 0, 1024))
-
-	val := config.NewValue(config.NewJson(data).Tocollate(clt).Tovalue())
-	value := val.Tojson(jsn).Tocbor(cbr).Tocollate(cltback).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
 	}
-	verbosef("collate2value2json2cbor ... ok\n")
-	return
-}
-
-func collate2json2cbor(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
+	// validate pointers with reference resolver, its edge pointers are
+	// checked only with -pointers.
+	switch doc.(type) {
+	case []interface{}, map[string]interface{}:
+		if !options.pointers {
+			break
+		}
+		err = verifyPointerConformance(params, doc)
+		bookcheck("pointerConformance", params, jsonstr, err)
+		if err != nil {
+			printFailure(config, "fail %v\njson: %v\n\n", err, jsonstr)
+			saveFailure(params, "pointerConformance", jsonstr, "", err)
+			return
 		}
-	}()
-	// json -> collate -> json -> cbor -> collate
-	_, ref := config.NewJson(data).Tovalue()
-	clt := config.NewCollate(make([]byte, 0, 1024))
-	jsn := config.NewJson(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	cltback := config.NewCollate(make([]byte, 0, 1024))
-
-	config.NewJson(data).Tocollate(clt).Tojson(jsn).Tocbor(cbr)
-	value := cbr.Tocollate(cltback).Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
 	}
-	verbosef("collate2json2cbor ... ok\n")
-	return
-}
-
-func collate2cbor(config *gson.Config, data []byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("panic recovered: %v\n", r)
-			fmt.Printf("%v\n", getStackTrace(2, debug.Stack()))
-			err = fmt.Errorf("%v", r)
+	switch doc.(type) {
+	case []interface{}, map[string]interface{}:
+		if !options.appends { // quadratic in document size.
+			break
+		}
+		err = verifyAppendDelete(params, jsonstr)
+		bookcheck("appendDelete", params, jsonstr, err)
+		if err != nil {
+			printFailure(config, "fail %v\njson: %v\n\n", err, jsonstr)
+			saveFailure(params, "appendDelete", jsonstr, "", err)
+			return
 		}
-	}()
-	// json -> collate -> cbor -> collate -> value
-	_, ref := config.NewJson(data).Tovalue()
-	clt := config.NewCollate(make([]byte, 0, 1024))
-	cbr := config.NewCbor(make([]byte, 0, 1024))
-	cltback := config.NewCollate(make([]byte, 0, 1024))
-	config.NewJson(data).Tocollate(clt).Tocbor(cbr).Tocollate(cltback)
-	value := cltback.Tovalue()
-	ref, value = gson.Fixtojson(config, ref), gson.Fixtojson(config, value)
-	if err := verifyobj(config, ref, value); err != nil {
-		return err
 	}
-	verbosef("collate2cbor ... ok\n")
+	// validate transforms
+	walkTransforms(config, data, options.depth, func(c chain, e error) bool {
+		bookcheck(c.String(), params, jsonstr, e)
+		if e != nil {
+			err = e
+			if perr, ok := err.(*panicError); ok {
+				fmt.Printf("panic recovered: %v\n", perr.r)
+				fmt.Printf("%v\n", perr.stack)
+			}
+			fmsg := "fail " + c.String() + ": %v\njson: %v\n\n"
+			printFailure(config, fmsg, err, jsonstr)
+			if options.trace {
+				printTrace(traceChain(config, data, c))
+			}
+			shrunk := ""
+			if options.shrink {
+				shrunk = shrink(jsonstr, chainFails(config, c))
+				write("original: %v\nshrunk  : %v\n\n", jsonstr, shrunk)
+			}
+			saveFailure(params, c.String(), jsonstr, shrunk, err)
+			return false
+		}
+		verbosef("%v ... ok\n", c)
+		return true
+	})
 	return
 }
 
@@ -534,9 +462,12 @@ func verifyValuePointers(config *gson.Config, doc interface{}) (err error) {
 	ndoc := cloneValue(config, doc)
 	doc, ndoc = gson.Fixtojson(config, doc), gson.Fixtojson(config, ndoc)
 	if !reflect.DeepEqual(doc, ndoc) {
-		fmsg := "fail verifyValuePointers:\n  expected: %v, got %v\n"
-		write(fmsg, doc, ndoc)
-		return errors.New("fail verifyValuePointers")
+		diff := structdiff.Diff(config, doc, ndoc)
+		if diff == "" {
+			diff = fmt.Sprintf("expected: %v, got %v", doc, ndoc)
+		}
+		write("fail verifyValuePointers:\n  %v\n", diff)
+		return errors.New("fail verifyValuePointers: " + diff)
 	}
 	verbosef("verifyValuePointers ... ok\n")
 	return nil
@@ -743,62 +674,103 @@ func cloneCbor(config *gson.Config, doc interface{}) (*gson.Cbor, error) {
 	return out1, nil
 }
 
-func makeConfig(mrand *rand.Rand) *gson.Config {
-	config := gson.NewDefaultConfig()
+// cfgparams are the choices that make up a gson.Config, unlike
+// gson.Config they can be saved along with a failure and rebuilt.
+type cfgparams struct {
+	NumberKind  string `json:"numberkind"`
+	SpaceKind   string `json:"spacekind"`
+	Container   string `json:"container"`
+	ArrayLen    bool   `json:"arraylenprefix"`
+	PropertyLen bool   `json:"propertylenprefix"`
+	Missing     bool   `json:"missing"`
+	Strict      bool   `json:"strict"`
+}
+
+func makeConfig(mrand *rand.Rand) (*gson.Config, cfgparams) {
 	nks := []string{"smart", "float"}
-	nk := nks[mrand.Intn(len(nks))]
-	switch nk {
+	wss := []string{"ansi", "unicode"}
+	cts := []string{"lenprefix", "stream"}
+	bools := []bool{true, false}
+
+	params := cfgparams{
+		NumberKind:  nks[mrand.Intn(len(nks))],
+		SpaceKind:   wss[mrand.Intn(len(wss))],
+		Container:   cts[mrand.Intn(len(cts))],
+		ArrayLen:    bools[mrand.Intn(2)],
+		PropertyLen: bools[mrand.Intn(2)],
+		Missing:     bools[mrand.Intn(2)],
+		Strict:      bools[mrand.Intn(2)],
+	}
+
+	bookparams(params)
+	return params.config(), params
+}
+
+// bookparams count the config choices in statistics.
+func bookparams(params cfgparams) {
+	switch params.NumberKind {
 	case "smart":
-		config = config.SetNumberKind(gson.SmartNumber)
 		incrparam("SmartNumber", 1)
 	case "float":
-		config = config.SetNumberKind(gson.FloatNumber)
 		incrparam("FloatNumber", 1)
 	}
-
-	wss := []string{"ansi", "unicode"}
-	ws := wss[mrand.Intn(len(wss))]
-	switch ws {
+	switch params.SpaceKind {
 	case "ansi":
-		config = config.SetSpaceKind(gson.AnsiSpace)
 		incrparam("AnsiSpace", 1)
 	case "unicode":
-		config = config.SetSpaceKind(gson.UnicodeSpace)
 		incrparam("UnicodeSpace", 1)
 	}
-
-	cts := []string{"lenprefix", "stream"}
-	ct := cts[mrand.Intn(len(cts))]
-	switch ct {
+	switch params.Container {
 	case "lenprefix":
-		config = config.SetContainerEncoding(gson.LengthPrefix)
 		incrparam("LengthPrefix", 1)
 	case "stream":
-		config = config.SetContainerEncoding(gson.Stream)
 		incrparam("Stream", 1)
 	}
-
-	bools := []bool{true, false}
-
-	sortbyarraylen, sortbyproplen := bools[mrand.Intn(2)], bools[mrand.Intn(2)]
-	config = config.SortbyArrayLen(sortbyarraylen)
-	config = config.SortbyPropertyLen(sortbyproplen)
-	if sortbyarraylen {
+	if params.ArrayLen {
 		incrparam("arrayLenPrefix", 1)
 	}
-	if sortbyproplen {
+	if params.PropertyLen {
 		incrparam("propertyLenPrefix", 1)
 	}
-
-	missing := bools[mrand.Intn(2)]
-	config = config.UseMissing(missing).SetStrict(false)
-	if missing {
+	if params.Missing {
 		incrparam("doMissing", 1)
 	}
-	//if strict {
-	//	incrparam("strict", 1)
-	//}
-	return config
+	if params.Strict {
+		incrparam("strict", 1)
+	}
+}
+
+func (params cfgparams) String() string {
+	fmsg := "%v,%v,%v,arraylen:%v,proplen:%v,missing:%v,strict:%v"
+	return fmt.Sprintf(fmsg, params.NumberKind, params.SpaceKind,
+		params.Container, params.ArrayLen, params.PropertyLen, params.Missing,
+		params.Strict)
+}
+
+// config build gson.Config from params.
+func (params cfgparams) config() *gson.Config {
+	config := gson.NewDefaultConfig()
+	switch params.NumberKind {
+	case "smart":
+		config = config.SetNumberKind(gson.SmartNumber)
+	case "float":
+		config = config.SetNumberKind(gson.FloatNumber)
+	}
+	switch params.SpaceKind {
+	case "ansi":
+		config = config.SetSpaceKind(gson.AnsiSpace)
+	case "unicode":
+		config = config.SetSpaceKind(gson.UnicodeSpace)
+	}
+	switch params.Container {
+	case "lenprefix":
+		config = config.SetContainerEncoding(gson.LengthPrefix)
+	case "stream":
+		config = config.SetContainerEncoding(gson.Stream)
+	}
+	config = config.SortbyArrayLen(params.ArrayLen)
+	config = config.SortbyPropertyLen(params.PropertyLen)
+	return config.UseMissing(params.Missing).SetStrict(params.Strict)
 }
 
 func incrparam(param string, delta int) {
@@ -807,9 +779,16 @@ func incrparam(param string, delta int) {
 	statistics[param] = statistics[param].(int) + delta
 }
 
-func bookstats(config *gson.Config, js string, doc interface{}, err error) {
+func bookstats(
+	config *gson.Config, params cfgparams, js string, doc interface{},
+	err error) {
+
+	bookcrosstab(params, err)
 	if err != nil {
 		incrparam("fail", 1)
+		statrw.Lock()
+		failconfigs[params.String()]++
+		statrw.Unlock()
 	} else {
 		incrparam("pass", 1)
 	}
@@ -882,12 +861,25 @@ func printStatistics() {
 	write(strings.Join(properties, ", ") + "\n")
 
 	properties = []string{}
-	keys = []string{"arrayLenPrefix", "propertyLenPrefix", "doMissing", "strict"}
+	keys = []string{
+		"arrayLenPrefix", "propertyLenPrefix", "doMissing", "strict",
+		"strictRejects",
+	}
 	for _, key := range keys {
 		value := statistics[key]
 		properties = append(properties, fmt.Sprintf("%v: %v", key, value))
 	}
 	write(strings.Join(properties, ", ") + "\n")
+
+	keys = []string{}
+	for key := range failconfigs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		write("failed config %v: %v\n", key, failconfigs[key])
+	}
+	printChecks()
 }
 
 func printFailure(config *gson.Config, fmsg string, err error, inp string) {
@@ -944,6 +936,9 @@ func write(fmsg string, args ...interface{}) {
 func verifyobj(config *gson.Config, ref interface{}, value interface{}) error {
 	val := config.NewValue(value)
 	if config.NewValue(ref).Compare(val) != 0 {
+		if diff := structdiff.Diff(config, ref, value); diff != "" {
+			return fmt.Errorf("verify(): %v", diff)
+		}
 		fmsg := "verify(): expected %T(%v), got %T(%v)"
 		return fmt.Errorf(fmsg, ref, ref, value, value)
 	}